@@ -1,7 +1,7 @@
 package sleepy
 
 import (
-	"encoding/json"
+	"errors"
 	"net/http"
 	"os"
 	"time"
@@ -16,23 +16,33 @@ var format = logging.MustStringFormatter(
 )
 
 ////////////////////////////////////////////////////////////////////////////////
-// A handler function that can service an API call.                           //
+// A handler function that can service an API call. Any error can be          //
+// returned, see HTTPError for how errors are turned into responses.          //
+//                                                                            //
+// The context of the request, r.Context(), carries the CallData, the route   //
+// variables and the matched Call. It is cancelled when the client goes away  //
+// or the Timeout of the call passes, so it should be passed on to databases  //
+// and other services that the handler calls.                                 //
 ////////////////////////////////////////////////////////////////////////////////
-type Handler func(http.ResponseWriter, *http.Request, CallData) (interface{}, *Error)
+type Handler func(http.ResponseWriter, *http.Request, CallData) (interface{}, error)
 
 ////////////////////////////////////////////////////////////////////////////////
 // A middleware handler that can do work before the API call handler. Filters //
 // can be applied to the whole API, a single resource, or a single call.      //
 // Filter's should not write any data to the ResponseWriter, instead they     //
-// should write data to CallData and return an Error if appropriate.          //
+// should write data to CallData and return an error if appropriate. See      //
+// AfterFilter and Middleware for work after the handler.                     //
 ////////////////////////////////////////////////////////////////////////////////
-type Filter func(*http.Request, CallData) *Error
+type Filter func(*http.Request, CallData) error
 
 ////////////////////////////////////////////////////////////////////////////////
 // A place to store arbitary data while the request is bounding between       //
-// different calls and handlers.                                              //
+// different calls and handlers. It lives in the context of the request, see  //
+// DataFromContext. Values should be stored under typed keys, see Key, which  //
+// keep their types and don't clash between packages. String keys still       //
+// work, e.g. d["auth"], but share a single namespace.                        //
 ////////////////////////////////////////////////////////////////////////////////
-type CallData map[string]interface{}
+type CallData map[interface{}]interface{}
 
 type API struct {
 	basePath       string
@@ -40,21 +50,40 @@ type API struct {
 	router         *mux.Router
 	resourceRouter *mux.Router
 	filters        []Filter
-	enableCORS     bool
+	after          []AfterFilter
+	wraps          []Middleware
+	errorRenderer  ErrorRenderer
+	panicHandler   PanicHandler
+	notFound       Handler
+	problemDetails bool
+	cors           *corsPolicy
+	schemes        map[string]Verifier
+	codecs         []Codec
+	decodeOptions  DecodeOptions
+	title          string
+	version        string
+	description    string
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // Create a new API that will handle HTTP requests on the base path. Use the  //
-// Register method to add resources to the API.                               //
+// Register method to add resources to the API. If enableCORS is true the     //
+// DefaultCORSConfig is used, see API.CORS for other policies.                //
 ////////////////////////////////////////////////////////////////////////////////
 func New(basePath string, enableCORS bool) *API {
 	api := &API{
-		resources:  make([]*Resource, 0),
-		router:     mux.NewRouter(),
-		basePath:   basePath,
-		enableCORS: enableCORS,
+		resources:     make([]*Resource, 0),
+		router:        mux.NewRouter(),
+		basePath:      basePath,
+		errorRenderer: RenderJSONError,
+		codecs:        []Codec{JSONCodec, XMLCodec, MessagePackCodec},
+	}
+	if enableCORS {
+		api.CORS(DefaultCORSConfig())
 	}
 	api.resourceRouter = api.router.PathPrefix(basePath).Subrouter()
+	api.router.MethodNotAllowedHandler = methodNotAllowed{api, api.router}
+	api.router.NotFoundHandler = notFound{api}
 
 	backend1 := logging.NewLogBackend(os.Stderr, "", 0)
 	backend2 := logging.NewLogBackend(os.Stderr, "", 0)
@@ -74,76 +103,117 @@ func (api *API) Filter(f Filter) {
 	api.filters = append(api.filters, f)
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// Set the handler used for requests that don't match any resource, or that   //
+// match a resource but none of its calls. An error returned by the handler   //
+// goes through the normal error pipeline, and a result is written with the   //
+// status 404, in the codec that the client accepts. By default every such    //
+// request gets an ErrNotFound.                                               //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) NotFound(h Handler) {
+	api.notFound = h
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // Adds a resource to the API. This will result in the API handling all of    //
 // the resource's calls at '/base/path/resourcepath/call/path'.               //
+//                                                                            //
+// The calls of the resource are checked first, see Validate. If there are    //
+// any problems a RegistrationError is returned and the resource is not       //
+// added.                                                                     //
 ////////////////////////////////////////////////////////////////////////////////
-func (api *API) Register(r *Resource) {
+func (api *API) Register(r *Resource) error {
+	resources := append(api.resources[:len(api.resources):len(api.resources)], r)
+	if err := checkResources(api, resources); err != nil {
+		return err
+	}
+
 	// Add the resource to our list
 	api.resources = append(api.resources, r)
+	r.api = api
 	r.construct(api.basePath)
 	api.resourceRouter.PathPrefix(r.path).Handler(r)
+	return nil
 }
 
 // Implement http Handler interface
-func (api *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Create data space
-	data := make(map[string]interface{})
+func (api *API) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	// Remember the status of the response for the log
+	w := &statusWriter{ResponseWriter: rw}
+
+	// Create data space, and make it available through the request context
+	data := make(CallData)
+	r = r.WithContext(withData(r.Context(), data))
 
 	// Time the application level call handling
-	data["_start"] = time.Now()
-
-	// Check for OPTIONS methods to handle CORS
-	if api.enableCORS {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE, PATCH")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			endCall(w, r, nil, data)
-			return
-		}
+	startKey.Set(data, time.Now())
+
+	defer api.recoverPanic(w, r, data, "api "+api.basePath)
+
+	// Apply the CORS policy, and answer preflight OPTIONS requests before any
+	// filters run. Other OPTIONS requests are answered with the Allow header
+	// of the matched path.
+	if api.handleCORS(w, r, data) {
+		return
 	}
 
 	// Run API level filters
 	for _, filter := range api.filters {
-		err := filter(r, data)
+		err := nilIfTypedNil(filter(r, data))
 		if err != nil {
-			endCall(w, r, err, data)
+			api.endCall(w, r, err, data)
 			return
 		}
 	}
 
-	api.router.ServeHTTP(w, r, data)
+	api.router.ServeHTTP(w, r)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Replace the function used to write error responses. The default renderer   //
+// is RenderJSONError.                                                        //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) RenderErrors(renderer ErrorRenderer) {
+	api.errorRenderer = renderer
+	api.problemDetails = false
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // Function that should be called at the very end of every single request.    //
 // It is responsible for logging the request and result. If the error is nil, //
 // the request will be logged as having been handled successfully.            //
-// If the error is not nil, then it will be logged AND this function will     //
-// write the appropriate error details to the client.                         //
-////////////////////////////////////////////////////////////////////////////////
-func endCall(w http.ResponseWriter, r *http.Request, e *Error, d CallData) {
-	startTime := d["_start"].(time.Time)
-	duration := time.Since(startTime) / 1000
-	if e == nil {
-		log.Notice("[200] [client %s]->[%s %s] [%d us] OK\n", r.RemoteAddr, r.Method, r.URL, duration)
-	} else {
-		w.Header().Set("Content-Type", "Application/JSON")
-		w.WriteHeader(e.HttpCode)
-		// Marshal the error into JSON
-		jb, err := json.Marshal(e)
-		if err != nil {
-			http.Error(w, "", http.StatusInternalServerError)
-			log.Critical("%s", err.Error())
-		}
-		w.Write(jb)
-		if e.HttpCode >= 500 {
-			log.Error("[%d] [client %s]->[%s %s] [%d us] %s: %s\n", e.HttpCode, r.RemoteAddr, r.Method, r.URL, duration, e.Msg, e.Err)
-		} else {
-			log.Warning("[%d] [client %s]->[%s %s] [%d us] %s: %s\n", e.HttpCode, r.RemoteAddr, r.Method, r.URL, duration, e.Msg, e.Err)
+// If the error is not nil, then it will be logged AND the error renderer of  //
+// the API will write the appropriate error details to the client. Errors     //
+// that don't implement HTTPError are sent as a 500 without any details.      //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) endCall(w http.ResponseWriter, r *http.Request, err error, d CallData) {
+	var duration time.Duration
+	if startTime, ok := startKey.Get(d); ok {
+		duration = time.Since(startTime) / 1000
+	}
+	if err == nil {
+		status := http.StatusOK
+		if sw := findStatusWriter(w); sw != nil && sw.status != 0 {
+			status = sw.status
 		}
+		log.Notice("[%d] [client %s]->[%s %s] [%d us] OK\n", status, r.RemoteAddr, r.Method, r.URL, duration)
+		return
+	}
+
+	var httpErr HTTPError
+	if !errors.As(err, &httpErr) {
+		httpErr = errHidden
+	}
+	api.errorRenderer(w, r, httpErr)
+
+	detail := err.Error()
+	if e, ok := err.(*Error); ok && e.Msg != "" {
+		detail = e.Msg + ": " + e.Err
+	}
+	status := httpErr.StatusCode()
+	if status >= 500 {
+		log.Error("[%d] [client %s]->[%s %s] [%d us] %s\n", status, r.RemoteAddr, r.Method, r.URL, duration, detail)
+	} else {
+		log.Warning("[%d] [client %s]->[%s %s] [%d us] %s\n", status, r.RemoteAddr, r.Method, r.URL, duration, detail)
 	}
 }
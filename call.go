@@ -1,109 +1,254 @@
 package sleepy
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
+	"errors"
 	"net/http"
 	"reflect"
+	"strings"
+	"time"
+
+	"github.com/tortis/sleepy/mux"
 )
 
 type Call struct {
+	resource      *Resource
 	path          string
 	method        string
 	operationName string
 	handler       Handler
 	filters       []Filter
+	after         []AfterFilter
+	wraps         []Middleware
+	use           []func(http.Handler) http.Handler
+	mount         http.Handler
+	security      []string
 	model         callDataModel
+	timeout       time.Duration
+	route         *mux.Route
+	decodeOpts    *DecodeOptions
+	patch         bool
+}
+
+// Implement the http.Handler interface.
+func (c *Call) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api := c.resource.api
+	d := DataFromContext(r.Context())
+	defer api.recoverPanic(w, r, d, c.name())
+
+	// Make the call available through the request context, and start the
+	// timeout of the call
+	ctx := context.WithValue(r.Context(), callKey, c)
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	r = r.WithContext(ctx)
+
+	if len(c.use) > 0 {
+		chain(http.HandlerFunc(c.serve), c.use).ServeHTTP(w, r)
+	} else {
+		c.serve(w, r)
+	}
 }
 
-// Implement the Handler interface.
-func (c *Call) ServeHTTP(w http.ResponseWriter, r *http.Request, d map[string]interface{}) {
-	// Parse url/path variables and store them in the *sleepy.Request
+// serve handles the request once the http middleware of the call, if any, has
+// passed it on.
+func (c *Call) serve(w http.ResponseWriter, r *http.Request) {
+	api := c.resource.api
+	ctx := r.Context()
+	d := DataFromContext(ctx)
+
+	// Authenticate the request with the security schemes of the call
+	if err := c.authenticate(w, r, d); err != nil {
+		api.endCall(w, r, err, d)
+		return
+	}
 
-	// Validate that required queryVars are present
-	apiErr := c.model.validateQueryVars(r, d)
+	// Mounted handlers only go through the filters
+	if c.mount != nil {
+		for _, filter := range c.filters {
+			if err := nilIfTypedNil(filter(r, d)); err != nil {
+				api.endCall(w, r, c.timedOut(ctx, err), d)
+				return
+			}
+		}
+		c.mount.ServeHTTP(w, r)
+		api.endCall(w, r, nil, d)
+		return
+	}
+
+	// Pick the codec of the response before anything is done, so that a
+	// client that can't read any of them gets a 406 without side effects
+	out, apiErr := api.responseCodec(r, c.model.bodyOut)
+	if apiErr != nil && c.hasResponseBody() {
+		api.endCall(w, r, apiErr, d)
+		return
+	}
+
+	// Parse url/path and query variables and store them in the CallData
+	apiErr = c.model.parseVars(r, d)
 	if apiErr != nil {
-		endCall(w, r, apiErr, d)
+		api.endCall(w, r, apiErr, d)
 		return
 	}
 
 	//Parse the request body into the reads model if applicable
-	if c.model.bodyIn.model != nil && r.Method != "GET" {
-		dec := json.NewDecoder(r.Body)
+	if c.patch && c.model.bodyIn.model != nil {
+		apiErr = c.decodePatch(w, r, d)
+		if apiErr != nil {
+			api.endCall(w, r, apiErr, d)
+			return
+		}
+	} else if c.model.bodyIn.model != nil && r.Method != "GET" {
+		in, apiErr := api.requestCodec(r)
+		if apiErr != nil {
+			api.endCall(w, r, apiErr, d)
+			return
+		}
 		payload := reflect.New(reflect.TypeOf(c.model.bodyIn.model)).Interface()
-		err := dec.Decode(payload)
-		if err != nil {
-			apiErr := ErrBadRequest(err.Error(), "Could not parse the request.", ERR_PARSE_REQUEST)
-			endCall(w, r, apiErr, d)
+		present, apiErr := c.decodeModel(w, r, in, payload)
+		if apiErr != nil {
+			api.endCall(w, r, apiErr, d)
 			return
 		}
-		apiErr := c.model.validateTagsIn(payload, r.Method == "POST")
+		apiErr = c.model.validateTagsIn(payload, present, r.Method == "POST")
 		if apiErr != nil {
-			endCall(w, r, apiErr, d)
+			api.endCall(w, r, apiErr, d)
 			return
 		}
-		d["body"] = payload
+		bodyKey.Set(d, payload)
 	}
 
 	// Call filters
 	for _, filter := range c.filters {
-		err := filter(r, d)
+		err := nilIfTypedNil(filter(r, d))
 		if err != nil {
-			endCall(w, r, err, d)
+			api.endCall(w, r, c.timedOut(ctx, err), d)
 			return
 		}
 	}
 
-	// Call handler
-	result, apiErr := c.handler(w, r, d)
-	if apiErr != nil {
-		endCall(w, r, apiErr, d)
+	// Call handler, wrapped by the middleware of the API, resource and call
+	result, err := c.wrappedHandler()(w, r, d)
+	if err = nilIfTypedNil(err); err != nil {
+		err = c.timedOut(ctx, err)
+	}
+
+	// A Response chooses the status and headers, and wraps the body. A copy
+	// is handed to the after filters, which may change it.
+	resp := &Response{Status: c.defaultStatus(), Headers: make(http.Header), Body: result}
+	explicit := false
+	switch res := result.(type) {
+	case Response:
+		resp.set(&res)
+		explicit = true
+	case *Response:
+		resp.set(res)
+		explicit = res != nil
+	}
+	// The headers are sent with errors too, e.g. the Retry-After of a 503
+	err = c.runAfter(r, d, resp, err)
+	for name, values := range resp.Headers {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	if err != nil {
+		api.endCall(w, r, err, d)
 		return
 	}
+	status, body := resp.Status, resp.Body
 
-	// Recover here
+	if body == nil || status == http.StatusNoContent || status == http.StatusNotModified {
+		if !explicit && status != http.StatusNoContent {
+			apiErr = ErrInternal("Call handler for " + c.name() + " did not return a response or an error.")
+			api.endCall(w, r, apiErr, d)
+			return
+		}
+		w.WriteHeader(status)
+		api.endCall(w, r, nil, d)
+		return
+	}
 
-	if result == nil {
-		apiErr = ErrInternal("Call handler for " + c.operationName + " did not return a response or an error.")
-		endCall(w, r, apiErr, d)
+	// Remove any fields that are write only or hidden, wherever they are
+	if body, err = scrub(body); err != nil {
+		apiErr = ErrInternal("Response from call handler for " + c.name() + " could not be encoded: " + err.Error())
+		api.endCall(w, r, apiErr, d)
 		return
 	}
 
-	// Remove any fields that are write only
-	// Get the value of the result
-	if c.model.bodyOut.model != nil {
-		rawVal := reflect.ValueOf(result)
-		var val reflect.Value
-		if rawVal.Kind() == reflect.Ptr {
-			val = rawVal.Elem()
-		} else {
-			val = rawVal
+	// Encode the result with the codec accepted by the client and write the
+	// response
+	if out == nil {
+		api.endCall(w, r, ErrNotAcceptable(r.Header.Get("Accept")), d)
+		return
+	}
+	var buf bytes.Buffer
+	if err := out.Encode(&buf, body); err != nil {
+		apiErr = ErrInternal("Response from call handler for " + c.name() + " could not be encoded as " + out.MediaType() + ": " + err.Error())
+		api.endCall(w, r, apiErr, d)
+		return
+	}
+	w.Header().Set("Content-Type", out.MediaType())
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+	api.endCall(w, r, nil, d)
+}
+
+// hasResponseBody reports if the call may write a body, so that it needs a
+// codec. Only calls whose successful responses are all declared as 204 or 304
+// never do, since a handler can return a body with any other status. Errors
+// don't count, they are written by endCall.
+func (c *Call) hasResponseBody() bool {
+	success := false
+	for _, out := range c.model.bodyOut {
+		if out.status >= 400 {
+			continue
 		}
-		// Then zero each field in the result that is marked as writeonly
-		for _, fieldIndex := range c.model.bodyOut.woFields {
-			field := val.FieldByIndex(fieldIndex)
-			field.Set(reflect.Zero(field.Type()))
+		if out.model != nil || (out.status != http.StatusNoContent && out.status != http.StatusNotModified) {
+			return true
 		}
+		success = success || out.status < 300
 	}
+	return !success
+}
 
-	// Marshal the result into json and write the response
-	jb, err := json.Marshal(result)
-	if err != nil {
-		apiErr = ErrInternal("Response from call handler for " + c.operationName + " could not be parsed to JSON.")
-		endCall(w, r, apiErr, d)
-		return
+// timedOut replaces the context error that is returned when the timeout of the
+// call passes with an ErrTimeout, since it would otherwise be hidden as a 500.
+func (c *Call) timedOut(ctx context.Context, err error) error {
+	var httpErr HTTPError
+	if ctx.Err() == context.DeadlineExceeded && errors.Is(err, context.DeadlineExceeded) && !errors.As(err, &httpErr) {
+		return ErrTimeout(c.name())
+	}
+	return err
+}
+
+// The name of the operation, as set with OperationName, or the method and path
+// of the call if it has no name.
+func (c *Call) GetOperationName() string {
+	return c.name()
+}
+
+func (c *Call) name() string {
+	if c.operationName != "" {
+		return c.operationName
 	}
-	w.Header().Set("Content-Type", "Application/JSON")
-	w.Write(jb)
-	endCall(w, r, nil, d)
+	return strings.TrimSpace(c.method + " " + c.resource.path + c.path)
+}
+
+// The HTTP method of the call.
+func (c *Call) GetMethod() string {
+	return c.method
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 //
 ////////////////////////////////////////////////////////////////////////////////
 func (c *Call) Method(method string) *Call {
-	if c.model.bodyIn.model != nil {
-		log.Critical("Cannot set method of call to GET since Reads() was set. GET calls do not have a body.")
-	}
 	c.method = method
 	return c
 }
@@ -125,59 +270,97 @@ func (c *Call) Filter(f Filter) *Call {
 }
 
 ////////////////////////////////////////////////////////////////////////////////
-//
+// Declare a string variable in the path of the call. Path variables are      //
+// always required. Min, Max and Pattern options constrain the value.         //
 ////////////////////////////////////////////////////////////////////////////////
-func (c *Call) PathParam(name, desc string) *Call {
-	c.model.pathVars = append(c.model.pathVars, inputVar{
-		typ:      "string",
-		name:     name,
-		desc:     desc,
-		required: true,
-	})
+func (c *Call) PathParam(name, desc string, opts ...VarOption) *Call {
+	c.model.pathVars = append(c.model.pathVars, newInputVar(varString, name, desc, true, opts))
 	return c
 }
 
 ////////////////////////////////////////////////////////////////////////////////
-//
+// Declare an integer variable in the path of the call.                       //
 ////////////////////////////////////////////////////////////////////////////////
-func (c *Call) QueryVar(name, description string, required bool) *Call {
-	c.model.queryVars = append(c.model.queryVars, inputVar{
-		typ:      "string",
-		name:     name,
-		desc:     description,
-		required: required,
-	})
+func (c *Call) PathParamInt(name, desc string, opts ...VarOption) *Call {
+	c.model.pathVars = append(c.model.pathVars, newInputVar(varInteger, name, desc, true, opts))
 	return c
 }
 
 ////////////////////////////////////////////////////////////////////////////////
-//
+// Declare a UUID variable in the path of the call. The value is lowercased   //
+// before it is stored in the Params.                                         //
 ////////////////////////////////////////////////////////////////////////////////
-func (c *Call) Reads(m interface{}) *Call {
-	// No body allowed in a GET call
-	if c.method == "GET" {
-		log.Critical("A GET call can not use Reads() because the GET method does not have a request body.")
-	}
+func (c *Call) PathParamUUID(name, desc string, opts ...VarOption) *Call {
+	c.model.pathVars = append(c.model.pathVars, newInputVar(varUUID, name, desc, true, opts))
+	return c
+}
 
-	// Confirm the model is a struct
-	if reflect.TypeOf(m).Kind() != reflect.Struct {
-		log.Critical("The model given to Reads() must be of kind 'Struct'")
-	}
+////////////////////////////////////////////////////////////////////////////////
+// Declare a string variable in the query of the call. Default, Min, Max and  //
+// Pattern options constrain the value.                                       //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) QueryVar(name, description string, required bool, opts ...VarOption) *Call {
+	c.model.queryVars = append(c.model.queryVars, newInputVar(varString, name, description, required, opts))
+	return c
+}
 
-	c.model.bodyIn.model = m
-	c.model.identifyFieldTagsIn(nil)
+////////////////////////////////////////////////////////////////////////////////
+// Declare an integer variable in the query of the call. Default, Min and Max //
+// options constrain the value.                                               //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) QueryVarInt(name, description string, required bool, opts ...VarOption) *Call {
+	c.model.queryVars = append(c.model.queryVars, newInputVar(varInteger, name, description, required, opts))
+	return c
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Declare a boolean variable in the query of the call. Any value accepted by //
+// strconv.ParseBool is allowed.                                              //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) QueryVarBool(name, description string, required bool, opts ...VarOption) *Call {
+	c.model.queryVars = append(c.model.queryVars, newInputVar(varBoolean, name, description, required, opts))
+	return c
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Declare a time variable in the query of the call. The value must be in the //
+// RFC 3339 format.                                                           //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) QueryVarTime(name, description string, required bool, opts ...VarOption) *Call {
+	c.model.queryVars = append(c.model.queryVars, newInputVar(varTime, name, description, required, opts))
+	return c
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Declare a query variable that must be one of the given values.             //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) QueryVarEnum(name, description string, required bool, values []string, opts ...VarOption) *Call {
+	opts = append([]VarOption{func(v *inputVar) { v.enum = values }}, opts...)
+	c.model.queryVars = append(c.model.queryVars, newInputVar(varEnum, name, description, required, opts))
 	return c
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 //
 ////////////////////////////////////////////////////////////////////////////////
-func (c *Call) Returns(m interface{}) *Call {
-	c.model.bodyOut.model = m
-	c.model.identifyFieldTagsOut(nil)
+func (c *Call) Reads(m interface{}) *Call {
+	// The model and the method are checked when the resource is registered,
+	// see API.Validate.
+	c.model.bodyIn.model = m
+	if isStructModel(m) {
+		c.model.bodyIn.rules = buildStructRules(reflect.TypeOf(m), make(map[reflect.Type]*structRules))
+	}
 	return c
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// Declare the model of the 200 response of the call. See ReturnsStatus for   //
+// other statuses.                                                            //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) Returns(m interface{}) *Call {
+	return c.ReturnsStatus(http.StatusOK, m)
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 //
 ////////////////////////////////////////////////////////////////////////////////
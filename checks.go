@@ -0,0 +1,206 @@
+package sleepy
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// The error returned by Register and Validate. It lists every problem that   //
+// was found in the calls of the API, so that all of them can be fixed at     //
+// once instead of showing up one by one as 500s at runtime.                  //
+////////////////////////////////////////////////////////////////////////////////
+type RegistrationError struct {
+	Problems []string
+}
+
+func (e *RegistrationError) Error() string {
+	return "sleepy: invalid API: " + strings.Join(e.Problems, "; ")
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Check the calls of every registered resource. Register already runs these  //
+// checks for each resource, Validate is useful to check the whole API once   //
+// more after all of the resources were built. The problems reported are:     //
+//                                                                            //
+// - calls without a handler or a method                                      //
+// - GET and DELETE calls that read a body                                    //
+// - Reads and Returns models that aren't structs, and invalid statuses       //
+// - path variables that don't appear in the path of the call                 //
+// - calls with the same method and path                                      //
+// - calls with the same operation name                                       //
+// - security schemes that weren't added with SecurityScheme                  //
+// - security schemes with unsafe settings, e.g. an empty JWT secret          //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) Validate() error {
+	return checkResources(api, api.resources)
+}
+
+func checkResources(api *API, resources []*Resource) error {
+	problems := api.checkSchemeConfigs()
+	routes := make(map[string]*Call)
+	names := make(map[string]*Call)
+	for _, res := range resources {
+		problems = append(problems, api.checkSchemes("resource "+res.path, res.security)...)
+		for _, call := range res.calls {
+			tpl := api.basePath + res.path + call.path
+			problems = append(problems, call.check(tpl)...)
+			problems = append(problems, api.checkSchemes("call "+call.name(), call.security)...)
+
+			route := strings.ToUpper(call.method) + " " + routeKey(tpl)
+			if other, ok := routes[route]; ok {
+				problems = append(problems, "calls "+other.name()+" and "+call.name()+" have the same method and path")
+			} else {
+				routes[route] = call
+			}
+
+			if call.operationName == "" {
+				continue
+			}
+			if _, ok := names[call.operationName]; ok {
+				problems = append(problems, "the operation name "+call.operationName+" is used by more than one call")
+			} else {
+				names[call.operationName] = call
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return &RegistrationError{Problems: problems}
+	}
+	return nil
+}
+
+// routeKey returns the path of a route template with its variables reduced to
+// their patterns. Variables are compared by position and pattern only, so
+// /{id} and /{uid} are the same route, but /{id:[0-9]+} and /{slug:[a-z-]+}
+// are not, since the router tells them apart.
+func routeKey(tpl string) string {
+	var key strings.Builder
+	level, start := 0, 0
+	for i := 0; i < len(tpl); i++ {
+		switch tpl[i] {
+		case '{':
+			if level == 0 {
+				start = i + 1
+			}
+			level++
+			continue
+		case '}':
+			level--
+			if level == 0 {
+				// The default pattern of the router for path variables
+				pattern := "[^/]+"
+				if parts := strings.SplitN(tpl[start:i], ":", 2); len(parts) == 2 {
+					pattern = parts[1]
+				}
+				key.WriteString("{" + pattern + "}")
+			}
+			continue
+		}
+		if level == 0 {
+			key.WriteByte(tpl[i])
+		}
+	}
+	return key.String()
+}
+
+// checkSchemes reports the security schemes used by owner that are unknown.
+func (api *API) checkSchemes(owner string, schemes []string) []string {
+	var problems []string
+	for _, name := range schemes {
+		if _, ok := api.schemes[name]; !ok {
+			problems = append(problems, owner+" uses the unknown security scheme '"+name+"', see SecurityScheme()")
+		}
+	}
+	return problems
+}
+
+// checkSchemeConfigs reports the problems of the settings of the verifiers of
+// the API, sorted by the name of their scheme.
+func (api *API) checkSchemeConfigs() []string {
+	names := make([]string, 0, len(api.schemes))
+	for name := range api.schemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var problems []string
+	for _, name := range names {
+		v, ok := api.schemes[name].(interface{ checkConfig() []string })
+		if !ok {
+			continue
+		}
+		for _, problem := range v.checkConfig() {
+			problems = append(problems, "security scheme '"+name+"': "+problem)
+		}
+	}
+	return problems
+}
+
+// check returns the problems of a single call, whose path template is tpl.
+func (c *Call) check(tpl string) []string {
+	var problems []string
+	if c.mount != nil {
+		return c.checkPathVars(tpl)
+	}
+	if c.handler == nil {
+		problems = append(problems, "call "+c.name()+" has no handler, see To()")
+	}
+	if c.method == "" {
+		problems = append(problems, "call "+c.name()+" has no method, see Method()")
+	}
+	if c.patch && c.model.bodyIn.model == nil {
+		problems = append(problems, "call "+c.name()+" uses Patch(), but has no Reads() model to patch")
+	}
+	if c.model.bodyIn.model != nil {
+		if m := strings.ToUpper(c.method); m == "GET" || m == "DELETE" {
+			problems = append(problems, "call "+c.name()+" uses Reads(), but "+m+" requests have no body")
+		}
+		if !isStructModel(c.model.bodyIn.model) {
+			problems = append(problems, "the model given to Reads() by call "+c.name()+" is not a struct")
+		}
+	}
+	for _, out := range c.model.bodyOut {
+		if out.status < 100 || out.status > 599 {
+			problems = append(problems, "call "+c.name()+" declares a response with the invalid status "+strconv.Itoa(out.status))
+		}
+		if out.model != nil && !isResponseModel(out.model) {
+			problems = append(problems, "the model given to Returns() by call "+c.name()+" is not a struct, or a slice, array or map")
+		}
+	}
+	return append(problems, c.checkPathVars(tpl)...)
+}
+
+// checkPathVars returns a problem for every path variable of the call that is
+// not in the template of its path.
+func (c *Call) checkPathVars(tpl string) []string {
+	_, names := parseTemplate(tpl)
+	var problems []string
+	for _, v := range c.model.pathVars {
+		found := false
+		for _, name := range names {
+			found = found || name == v.name
+		}
+		if !found {
+			problems = append(problems, "call "+c.name()+" declares the path variable '"+v.name+"' but its path "+tpl+" does not contain it")
+		}
+	}
+	return problems
+}
+
+func isStructModel(m interface{}) bool {
+	return m != nil && reflect.TypeOf(m).Kind() == reflect.Struct
+}
+
+// Responses can also be lists or maps, e.g. []User{} or map[string]User{}.
+func isResponseModel(m interface{}) bool {
+	if m == nil {
+		return false
+	}
+	switch reflect.TypeOf(m).Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package sleepy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDuplicateRoutes(t *testing.T) {
+	tests := []struct {
+		title     string
+		paths     []string
+		duplicate bool
+	}{
+		{"different names", []string{"/{id}", "/{uid}"}, true},
+		{"same pattern", []string{"/{id:[0-9]+}", "/{n:[0-9]+}"}, true},
+		{"default pattern", []string{"/{id}", "/{id:[^/]+}"}, true},
+		{"different patterns", []string{"/{id:[0-9]+}", "/{slug:[a-z-]+}"}, false},
+		{"pattern and none", []string{"/{id:[0-9]+}", "/{slug}"}, false},
+		{"nested braces", []string{"/{id:[0-9]{4}}", "/{id:[0-9]{5}}"}, false},
+		{"different paths", []string{"/{id}", "/{id}/owner"}, false},
+	}
+	for _, test := range tests {
+		res := NewResource("/items")
+		for _, path := range test.paths {
+			res.Route(path).Method("GET").ReturnsNoContent().
+				To(func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+					return nil, nil
+				})
+		}
+		err := New("/api", false).Register(res)
+		if duplicate := err != nil && strings.Contains(err.Error(), "same method and path"); duplicate != test.duplicate {
+			t.Errorf("%s: Register returned %v", test.title, err)
+		}
+	}
+
+	// Both calls are reachable
+	res := NewResource("/items")
+	for _, path := range []string{"/{id:[0-9]+}", "/{slug:[a-z-]+}"} {
+		res.Route(path).Method("GET").Returns(map[string]string{}).
+			To(func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+				return map[string]string{"route": CallFromContext(r.Context()).path}, nil
+			})
+	}
+	runCases(t, newTestAPI(t, res), []httpCase{
+		{title: "pattern", url: "/api/items/42", status: http.StatusOK, check: hasJSON("route", "/{id:[0-9]+}")},
+		{title: "other pattern", url: "/api/items/a-slug", status: http.StatusOK, check: hasJSON("route", "/{slug:[a-z-]+}")},
+	})
+}
@@ -0,0 +1,278 @@
+package sleepy
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// A Codec reads request bodies and writes response bodies of one media type. //
+// JSON, XML and MessagePack are built in, and other formats, e.g. CBOR, can  //
+// be added to an API with RegisterCodec. The models of the calls are given   //
+// to every codec, so the same model can carry json and xml tags.             //
+////////////////////////////////////////////////////////////////////////////////
+type Codec interface {
+	// The media type of the codec, e.g. application/json.
+	MediaType() string
+	// Write v to w.
+	Encode(w io.Writer, v interface{}) error
+	// Read the body r into v, which is a pointer.
+	Decode(r io.Reader, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) MediaType() string { return "application/json" }
+
+func (jsonCodec) Encode(w io.Writer, v interface{}) error {
+	jb, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(jb)
+	return err
+}
+
+func (jsonCodec) Decode(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+type xmlCodec struct{}
+
+func (xmlCodec) MediaType() string { return "application/xml" }
+
+func (xmlCodec) Encode(w io.Writer, v interface{}) error {
+	xb, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(xb)
+	return err
+}
+
+func (xmlCodec) Decode(r io.Reader, v interface{}) error {
+	return xml.NewDecoder(r).Decode(v)
+}
+
+// encoding/xml can't encode maps, so models that hold one aren't sent as XML.
+// Lists aren't either, since they are encoded as a run of elements without a
+// root and the document wouldn't be well-formed.
+func (xmlCodec) canEncode(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		return false
+	}
+	return !holdsMap(t, make(map[reflect.Type]bool))
+}
+
+// holdsMap reports if values of type t are or contain a map that encoding/xml
+// would have to encode.
+func holdsMap(t reflect.Type, seen map[reflect.Type]bool) bool {
+	switch t.Kind() {
+	case reflect.Map:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return holdsMap(t.Elem(), seen)
+	case reflect.Struct:
+		if seen[t] {
+			return false
+		}
+		seen[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if (field.PkgPath != "" && !field.Anonymous) || field.Tag.Get("xml") == "-" {
+				continue
+			}
+			if holdsMap(field.Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// modelEncoder is implemented by codecs that can't encode every model, so that
+// the negotiation of a call passes them over if they can't encode its models.
+type modelEncoder interface {
+	canEncode(t reflect.Type) bool
+}
+
+// The codec for JSON, which is also used for requests without a Content-Type
+// and for clients that accept anything.
+var JSONCodec Codec = jsonCodec{}
+
+// The codec for XML, using encoding/xml.
+var XMLCodec Codec = xmlCodec{}
+
+// The codec for MessagePack. See msgpack.go.
+var MessagePackCodec Codec = msgpackCodec{}
+
+////////////////////////////////////////////////////////////////////////////////
+// Add a codec to the API, or replace the codec of the same media type. The   //
+// codecs are preferred in the order they were added when a client accepts    //
+// several of them equally.                                                   //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) RegisterCodec(c Codec) {
+	for i, existing := range api.codecs {
+		if strings.EqualFold(existing.MediaType(), c.MediaType()) {
+			api.codecs[i] = c
+			return
+		}
+	}
+	api.codecs = append(api.codecs, c)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Replace all of the codecs of the API, e.g. to only serve JSON. The first   //
+// codec is used for requests without a Content-Type.                         //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) Codecs(codecs ...Codec) {
+	api.codecs = nil
+	for _, c := range codecs {
+		api.RegisterCodec(c)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Find the codec for the Content-Type of a request body. The first codec     //
+// reads bodies without a Content-Type, and structured syntax suffixes like   //
+// application/merge-patch+json are read by the codec of the suffix.          //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) requestCodec(r *http.Request) (Codec, *Error) {
+	header := r.Header.Get("Content-Type")
+	if header == "" && len(api.codecs) > 0 {
+		return api.codecs[0], nil
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return nil, ErrUnsupportedMediaType(header)
+	}
+	for _, c := range api.codecs {
+		if strings.EqualFold(c.MediaType(), mediaType) {
+			return c, nil
+		}
+	}
+	if i := strings.LastIndex(mediaType, "+"); i >= 0 {
+		for _, c := range api.codecs {
+			if strings.EqualFold(c.MediaType(), "application/"+mediaType[i+1:]) {
+				return c, nil
+			}
+		}
+	}
+	return nil, ErrUnsupportedMediaType(header)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Pick the codec for the response from the Accept header of the request. The //
+// codec with the highest q-value wins, where the q-value of a codec comes    //
+// from the most specific media range that matches it. Ties go to the codec   //
+// that was registered first, and so do requests without an Accept header.    //
+// Codecs that can't encode one of the response models of the call, like XML  //
+// for maps, are passed over.                                                 //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) responseCodec(r *http.Request, models []modelOut) (Codec, *Error) {
+	header := strings.Join(r.Header["Accept"], ",")
+	ranges := []mediaRange{{typ: "*", subtype: "*", q: 1}}
+	if strings.TrimSpace(header) != "" {
+		ranges = parseAccept(header)
+	}
+	var best Codec
+	bestQ := 0.0
+	for _, c := range api.codecs {
+		if !canEncode(c, models) {
+			continue
+		}
+		if q := acceptQuality(ranges, c.MediaType()); q > bestQ {
+			best, bestQ = c, q
+		}
+	}
+	if best == nil {
+		return nil, ErrNotAcceptable(header)
+	}
+	return best, nil
+}
+
+// canEncode reports if the codec can encode every one of the models.
+func canEncode(c Codec, models []modelOut) bool {
+	me, ok := c.(modelEncoder)
+	if !ok {
+		return true
+	}
+	for _, out := range models {
+		if out.model != nil && !me.canEncode(reflect.TypeOf(out.model)) {
+			return false
+		}
+	}
+	return true
+}
+
+// mediaRange is one entry of an Accept header.
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+func parseAccept(header string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		mr := mediaRange{q: 1}
+		slash := strings.Index(mediaType, "/")
+		if slash < 0 {
+			// Some clients send a bare * for */*.
+			if mediaType != "*" {
+				continue
+			}
+			mr.typ, mr.subtype = "*", "*"
+		} else {
+			mr.typ, mr.subtype = mediaType[:slash], mediaType[slash+1:]
+		}
+		if q, ok := params["q"]; ok {
+			f, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			mr.q = f
+		}
+		ranges = append(ranges, mr)
+	}
+	// The most specific ranges first, so that the first match is the one that
+	// gives the q-value.
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].specificity() > ranges[j].specificity()
+	})
+	return ranges
+}
+
+func (mr mediaRange) specificity() int {
+	switch {
+	case mr.typ == "*":
+		return 0
+	case mr.subtype == "*":
+		return 1
+	}
+	return 2
+}
+
+func acceptQuality(ranges []mediaRange, mediaType string) float64 {
+	slash := strings.Index(mediaType, "/")
+	typ, subtype := strings.ToLower(mediaType[:slash]), strings.ToLower(mediaType[slash+1:])
+	for _, mr := range ranges {
+		if (mr.typ == "*" || mr.typ == typ) && (mr.subtype == "*" || mr.subtype == subtype) {
+			return mr.q
+		}
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package sleepy
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type codecItem struct {
+	Name  string `json:"name" xml:"name"`
+	Count int    `json:"count" xml:"count"`
+}
+
+type codecTagged struct {
+	Name  string            `json:"name" xml:"name"`
+	Extra map[string]string `json:"extra" xml:"-"`
+}
+
+func TestCodecs(t *testing.T) {
+	res := NewResource("/codec")
+	res.Route("/item").Method("GET").Returns(codecItem{}).To(returns(codecItem{Name: "a", Count: 1}, nil))
+	res.Route("/map").Method("GET").Returns(map[string]codecItem{}).To(returns(map[string]codecItem{"a": {Name: "a"}}, nil))
+	res.Route("/tagged").Method("GET").Returns(codecTagged{}).To(returns(codecTagged{Name: "a", Extra: map[string]string{"b": "c"}}, nil))
+	res.Route("/list").Method("GET").Returns([]codecItem{}).To(returns([]codecItem{{Name: "a"}, {Name: "b"}}, nil))
+	res.Route("/echo").Method("POST").Reads(codecItem{}).Returns(codecItem{}).To(echo)
+
+	accept := func(title, url, accept string, status int, contentType string) httpCase {
+		c := httpCase{title: title, url: url, headers: []string{"Accept", accept}, status: status}
+		if contentType != "" {
+			c.check = hasHeader("Content-Type", contentType)
+		}
+		return c
+	}
+	send := func(title, body, contentType string, status int, check responseCheck) httpCase {
+		return httpCase{title: title, method: "POST", url: "/api/codec/echo", body: body, headers: []string{"Content-Type", contentType}, status: status, check: check}
+	}
+	runCases(t, newTestAPI(t, res), []httpCase{
+		accept("no Accept", "/api/codec/item", "", http.StatusOK, "application/json"),
+		accept("any", "/api/codec/item", "*/*", http.StatusOK, "application/json"),
+		accept("xml", "/api/codec/item", "application/xml", http.StatusOK, "application/xml"),
+		accept("msgpack", "/api/codec/item", "application/msgpack", http.StatusOK, "application/msgpack"),
+		accept("q-values", "/api/codec/item", "application/json;q=0.5, application/xml", http.StatusOK, "application/xml"),
+		accept("excluded", "/api/codec/item", "application/*, application/json;q=0", http.StatusOK, "application/xml"),
+		accept("not acceptable", "/api/codec/item", "text/html", http.StatusNotAcceptable, ""),
+		accept("map as xml", "/api/codec/map", "application/xml", http.StatusNotAcceptable, ""),
+		accept("map falls back", "/api/codec/map", "application/xml, application/json;q=0.5", http.StatusOK, "application/json"),
+		accept("map as any", "/api/codec/map", "application/*", http.StatusOK, "application/json"),
+		accept("list as xml", "/api/codec/list", "application/xml", http.StatusNotAcceptable, ""),
+		accept("list falls back", "/api/codec/list", "application/xml, application/json;q=0.5", http.StatusOK, "application/json"),
+		accept("skipped map field as xml", "/api/codec/tagged", "application/xml", http.StatusOK, "application/xml"),
+
+		send("json", `{"name": "a", "count": 2}`, "application/json", http.StatusOK, hasBody(`"count":2`)),
+		send("json with charset", `{"name": "a", "count": 2}`, "application/json; charset=utf-8", http.StatusOK, hasBody(`"count":2`)),
+		send("suffix", `{"name": "a", "count": 2}`, "application/vnd.item+json", http.StatusOK, hasBody(`"count":2`)),
+		send("xml", `<codecItem><name>a</name><count>3</count></codecItem>`, "application/xml", http.StatusOK, hasBody(`"count":3`)),
+		send("unsupported", `name=a`, "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType, nil),
+		send("invalid", `{"name": "a", "count": 2}`, "not a media type", http.StatusUnsupportedMediaType, nil),
+		send("malformed json", `{"name": `, "application/json", http.StatusUnprocessableEntity, hasJSON("code", float64(ERR_PARSE_REQUEST))),
+	})
+}
+
+func TestNotAcceptableBeforeHandler(t *testing.T) {
+	// The handler records that it ran, and returns a body with any status
+	ran := map[string]bool{}
+	handler := func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+		ran[r.URL.Path] = true
+		return codecItem{Name: "a"}, nil
+	}
+	res := NewResource("/codec")
+	res.Route("/accepted").Method("POST").ReturnsStatus(http.StatusAccepted, nil).To(handler)
+	res.Route("/errors").Method("POST").ReturnsStatus(http.StatusNotFound, nil).To(handler)
+	res.Route("/empty").Method("DELETE").ReturnsNoContent().
+		To(func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+			ran[r.URL.Path] = true
+			return nil, nil
+		})
+
+	html := []string{"Accept", "text/html"}
+	runCases(t, newTestAPI(t, res), []httpCase{
+		{title: "status without a model", method: "POST", url: "/api/codec/accepted", headers: html, status: http.StatusNotAcceptable},
+		{title: "only errors declared", method: "POST", url: "/api/codec/errors", headers: html, status: http.StatusNotAcceptable},
+		{title: "no content", method: "DELETE", url: "/api/codec/empty", headers: html, status: http.StatusNoContent},
+	})
+	if want := map[string]bool{"/api/codec/empty": true}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("got handlers %v run, want %v", ran, want)
+	}
+}
@@ -0,0 +1,47 @@
+package sleepy
+
+import (
+	"context"
+	"time"
+)
+
+type contextKey int
+
+const (
+	dataKey contextKey = iota
+	callKey
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// Get the CallData of a request from its context. Every request handled by   //
+// the API carries its CallData, so filters and handlers can hand the         //
+// context to other packages, e.g. a data layer, which can still read it.     //
+// Returns nil if the context does not belong to a sleepy request.            //
+////////////////////////////////////////////////////////////////////////////////
+func DataFromContext(ctx context.Context) CallData {
+	d, _ := ctx.Value(dataKey).(CallData)
+	return d
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Get the Call that was matched for a request from its context. Returns nil  //
+// before a call has been matched, e.g. in API and resource filters.          //
+////////////////////////////////////////////////////////////////////////////////
+func CallFromContext(ctx context.Context) *Call {
+	c, _ := ctx.Value(callKey).(*Call)
+	return c
+}
+
+func withData(ctx context.Context, d CallData) context.Context {
+	return context.WithValue(ctx, dataKey, d)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Limit how long the filters and handler of the call may take. The context   //
+// of the request is cancelled when the timeout passes, and a handler that    //
+// then returns the error of the context is answered with an ErrTimeout.      //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) Timeout(d time.Duration) *Call {
+	c.timeout = d
+	return c
+}
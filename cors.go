@@ -0,0 +1,184 @@
+package sleepy
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tortis/sleepy/mux"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// The cross-origin resource sharing policy of an API or Resource.            //
+//                                                                            //
+// - AllowedOrigins:   Origins that may make cross-origin requests. An entry  //
+//                     may use * as a wildcard, as in https://*.example.com,  //
+//                     and a single * allows every origin.                    //
+// - AllowOriginFunc:  Optional predicate that can allow more origins.        //
+// - AllowedHeaders:   Request headers the client may send.                   //
+// - ExposedHeaders:   Response headers the client may read.                  //
+// - AllowCredentials: Allow cookies and Authorization with requests. The     //
+//                     origin is then always echoed, never sent as *.         //
+// - MaxAge:           How long the client may cache a preflight response.    //
+//                                                                            //
+// Preflight requests are answered with the methods of the calls that are     //
+// registered for the requested path.                                         //
+////////////////////////////////////////////////////////////////////////////////
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowOriginFunc  func(origin string) bool
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// The policy used when New is called with enableCORS. Any origin may call    //
+// the API, but without credentials.                                          //
+////////////////////////////////////////////////////////////////////////////////
+func DefaultCORSConfig() *CORSConfig {
+	return &CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedHeaders: []string{"Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization"},
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Set the CORS policy of the whole API. A nil config turns CORS off.         //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) CORS(cfg *CORSConfig) {
+	api.cors = newCORSPolicy(cfg)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Override the CORS policy of the API for the calls of this resource.        //
+////////////////////////////////////////////////////////////////////////////////
+func (r *Resource) CORS(cfg *CORSConfig) {
+	r.cors = newCORSPolicy(cfg)
+}
+
+// corsPolicy is a CORSConfig with its origin patterns compiled.
+type corsPolicy struct {
+	cfg       CORSConfig
+	anyOrigin bool
+	origins   []*regexp.Regexp
+}
+
+func newCORSPolicy(cfg *CORSConfig) *corsPolicy {
+	if cfg == nil {
+		return nil
+	}
+	p := &corsPolicy{cfg: *cfg}
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			p.anyOrigin = true
+			continue
+		}
+		parts := strings.Split(origin, "*")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		p.origins = append(p.origins, regexp.MustCompile("^(?i)"+strings.Join(parts, "[^/]*")+"$"))
+	}
+	return p
+}
+
+// usesCORS reports if the API or any of its resources has a CORS policy.
+func (api *API) usesCORS() bool {
+	if api.cors != nil {
+		return true
+	}
+	for _, res := range api.resources {
+		if res.cors != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	for _, re := range p.origins {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return p.cfg.AllowOriginFunc != nil && p.cfg.AllowOriginFunc(origin)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Apply the CORS policy that covers the request. Returns true if the request //
+// was a preflight request, which is then completely answered.                //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) handleCORS(w http.ResponseWriter, r *http.Request, d CallData) bool {
+	if !api.usesCORS() {
+		return false
+	}
+	// Find the resource, if any, so that its policy and calls can be used.
+	policy, router := api.cors, api.router
+	var match mux.RouteMatch
+	if api.router.Match(r, &match) {
+		if res, ok := match.Handler.(*Resource); ok {
+			router = res.router
+			if res.cors != nil {
+				policy = res.cors
+			}
+		}
+	}
+	if policy == nil {
+		return false
+	}
+
+	h := w.Header()
+	// The response depends on the origin unless every origin gets a "*".
+	if !policy.anyOrigin || policy.cfg.AllowCredentials {
+		h.Add("Vary", "Origin")
+	}
+	origin := r.Header.Get("Origin")
+	preflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+	if preflight {
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+	}
+	if origin == "" || !policy.allowOrigin(origin) {
+		if preflight {
+			w.WriteHeader(http.StatusNoContent)
+			api.endCall(w, r, nil, d)
+		}
+		return preflight
+	}
+
+	if policy.anyOrigin && !policy.cfg.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if policy.cfg.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if !preflight {
+		if len(policy.cfg.ExposedHeaders) > 0 {
+			h.Set("Access-Control-Expose-Headers", strings.Join(policy.cfg.ExposedHeaders, ", "))
+		}
+		return false
+	}
+
+	methods := router.AllowedMethods(r)
+	if len(methods) > 0 {
+		h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	}
+	if len(policy.cfg.AllowedHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(policy.cfg.AllowedHeaders, ", "))
+	}
+	if policy.cfg.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.cfg.MaxAge/time.Second)))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	api.endCall(w, r, nil, d)
+	return true
+}
@@ -0,0 +1,94 @@
+package sleepy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	items := NewResource("/items")
+	items.Route("").Method("GET").Returns([]string{}).To(returns([]string{"a"}, nil))
+	items.Route("").Method("POST").Reads(codecItem{}).Returns(codecItem{}).To(echo)
+
+	// The resource overrides the policy of the API with one that allows
+	// credentials
+	private := NewResource("/private")
+	private.Route("").Method("GET").Returns([]string{}).To(returns([]string{"b"}, nil))
+	private.CORS(&CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true})
+
+	api := New("/api", false)
+	api.CORS(&CORSConfig{
+		AllowedOrigins: []string{"https://*.example.com"},
+		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		ExposedHeaders: []string{"X-Total"},
+		MaxAge:         10 * time.Minute,
+	})
+	register(t, api, items, private)
+
+	preflight := func(origin, method string) []string {
+		return []string{"Origin", origin, "Access-Control-Request-Method", method}
+	}
+	vary := func(want ...string) responseCheck {
+		return func(t *testing.T, w *httptest.ResponseRecorder) {
+			t.Helper()
+			if got := w.Header()["Vary"]; !reflect.DeepEqual(got, want) {
+				t.Errorf("got Vary %q, want %q", got, want)
+			}
+		}
+	}
+	runCases(t, api, []httpCase{
+		{title: "allowed preflight", method: "OPTIONS", url: "/api/items", headers: preflight("https://app.example.com", "POST"), status: http.StatusNoContent,
+			check: all(
+				hasHeader("Access-Control-Allow-Origin", "https://app.example.com"),
+				hasHeader("Access-Control-Allow-Methods", "GET, POST"),
+				hasHeader("Access-Control-Allow-Headers", "Content-Type, Authorization"),
+				hasHeader("Access-Control-Max-Age", "600"),
+				hasHeader("Access-Control-Allow-Credentials", ""),
+				vary("Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"),
+			)},
+		{title: "disallowed preflight", method: "OPTIONS", url: "/api/items", headers: preflight("https://evil.com", "POST"), status: http.StatusNoContent,
+			check: all(
+				hasHeader("Access-Control-Allow-Origin", ""),
+				hasHeader("Access-Control-Allow-Methods", ""),
+				vary("Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"),
+			)},
+		{title: "wildcard doesn't match the parent domain", method: "OPTIONS", url: "/api/items", headers: preflight("https://example.com", "GET"), status: http.StatusNoContent,
+			check: hasHeader("Access-Control-Allow-Origin", "")},
+		{title: "allowed request", url: "/api/items", headers: []string{"Origin", "https://app.example.com"}, status: http.StatusOK,
+			check: all(
+				hasHeader("Access-Control-Allow-Origin", "https://app.example.com"),
+				hasHeader("Access-Control-Expose-Headers", "X-Total"),
+				hasHeader("Access-Control-Allow-Methods", ""),
+				vary("Origin", "Accept"),
+			)},
+		{title: "disallowed request", url: "/api/items", headers: []string{"Origin", "https://evil.com"}, status: http.StatusOK,
+			check: all(hasHeader("Access-Control-Allow-Origin", ""), hasHeader("Access-Control-Expose-Headers", ""))},
+		{title: "credentials echo the origin", url: "/api/private", headers: []string{"Origin", "https://app.example.com"}, status: http.StatusOK,
+			check: all(
+				hasHeader("Access-Control-Allow-Origin", "https://app.example.com"),
+				hasHeader("Access-Control-Allow-Credentials", "true"),
+			)},
+		{title: "resource policy replaces the API policy", url: "/api/private", headers: []string{"Origin", "https://other.example.com"}, status: http.StatusOK,
+			check: hasHeader("Access-Control-Allow-Origin", "")},
+		{title: "options without a preflight", method: "OPTIONS", url: "/api/items", headers: []string{"Origin", "https://app.example.com"}, status: http.StatusNoContent,
+			check: all(
+				hasHeader("Allow", "GET, POST, OPTIONS"),
+				hasHeader("Access-Control-Allow-Origin", "https://app.example.com"),
+				hasHeader("Access-Control-Allow-Methods", ""),
+			)},
+	})
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	res := NewResource("/items")
+	res.Route("").Method("GET").Returns([]string{}).To(returns([]string{"a"}, nil))
+	runCases(t, register(t, New("/api", true), res), []httpCase{
+		{title: "any origin", url: "/api/items", headers: []string{"Origin", "https://app.example.com"}, status: http.StatusOK,
+			check: all(hasHeader("Access-Control-Allow-Origin", "*"), hasHeader("Access-Control-Allow-Credentials", ""), hasHeader("Vary", "Accept"))},
+		{title: "no origin", url: "/api/items", status: http.StatusOK,
+			check: hasHeader("Access-Control-Allow-Origin", "")},
+	})
+}
@@ -0,0 +1,76 @@
+package sleepy
+
+import (
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// A typed key of the CallData. Keys are compared by identity, not by name,   //
+// so two packages that both create a "user" key never see each other's       //
+// values, and the value of a key always has its type. Create keys once, as   //
+// package level variables:                                                   //
+//                                                                            //
+//   var UserKey = sleepy.NewKey[*User]("user")                               //
+//                                                                            //
+//   func authFilter(r *http.Request, d sleepy.CallData) error {              //
+//       UserKey.Set(d, user)                                                 //
+//       ...                                                                  //
+//   }                                                                        //
+//                                                                            //
+//   user, ok := UserKey.Get(d)                                               //
+////////////////////////////////////////////////////////////////////////////////
+type Key[T any] struct {
+	name string
+}
+
+// Create a new key. The name is only used to describe the key.
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+// The name of the key.
+func (k *Key[T]) String() string {
+	return k.name
+}
+
+// Get the value of the key, and whether it was set.
+func (k *Key[T]) Get(d CallData) (T, bool) {
+	v, ok := d[k].(T)
+	return v, ok
+}
+
+// Get the value of the key, or the zero value of T if it wasn't set.
+func (k *Key[T]) Value(d CallData) T {
+	v, _ := k.Get(d)
+	return v
+}
+
+// Set the value of the key.
+func (k *Key[T]) Set(d CallData, v T) {
+	d[k] = v
+}
+
+// Remove the value of the key.
+func (k *Key[T]) Delete(d CallData) {
+	delete(d, k)
+}
+
+// The values that sleepy itself keeps in the CallData. The keys aren't
+// exported, so they can't clash with the keys of filters and handlers.
+var (
+	startKey  = NewKey[time.Time]("start")
+	bodyKey   = NewKey[interface{}]("body")
+	paramsKey = NewKey[Params]("params")
+	patchKey  = NewKey[*Patch]("patch")
+
+	principalKey = NewKey[*Principal]("principal")
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// Get the request body of the call, decoded into a pointer to its Reads()    //
+// model. Returns nil for calls without a body. See Handle for handlers that  //
+// get the body with its type.                                                //
+////////////////////////////////////////////////////////////////////////////////
+func (d CallData) Body() interface{} {
+	return bodyKey.Value(d)
+}
@@ -1,8 +1,8 @@
 package sleepy
 
 import (
-	"net/http"
 	"reflect"
+	"regexp"
 	"strings"
 )
 
@@ -11,10 +11,10 @@ import (
 // that is used as the data in/out model are required, readonly, writeony,    //
 // or hidden.                                                                 //
 //                                                                            //
-// - required:  Fields marked as required must be present (non-zero) in the   //
-// 			    request body of a POST request. If a required field is not    //
-//              present in the request, the handling will end before the API  //
-//              call handler sees the request.                                //
+// - required:  Fields marked as required must be present in the request      //
+//              body of a POST request, even if only as false, 0 or null. If  //
+//              a required field is not present in the request, the handling  //
+//              will end before the API call handler sees the request.        //
 //                                                                            //
 // - readonly:  Fields marked as readonly must NOT be present in the request  //
 //              body of a POST/PUT/PATCH/etc request. If a readonly field is  //
@@ -26,6 +26,9 @@ import (
 //              stopping the password field from being sent to the client.    //
 //              This tag should normally accompany the json/xml omitempty     //
 //              tag, so that the field will not be marshaled.                 //
+//                                                                            //
+// - hidden:    Fields marked as hidden are left out of the documentation,    //
+//              and are removed from responses like writeonly fields.         //
 ////////////////////////////////////////////////////////////////////////////////
 const (
 	sleepyRequired  = "required"
@@ -43,7 +46,7 @@ const (
 ////////////////////////////////////////////////////////////////////////////////
 type callDataModel struct {
 	bodyIn    modelIn
-	bodyOut   modelOut
+	bodyOut   []modelOut
 	pathVars  []inputVar
 	queryVars []inputVar
 }
@@ -54,160 +57,109 @@ type callDataModel struct {
 // that are tagged with tags that are relevant to input (required, readonly)  //
 // Sleepy tags on the model are enforced, so if a modelIn field is taged as   //
 // required, but is not present in the request, the call will be terminateda  //
-// with a semantic http error 422.                                            //
+// with a semantic http error 422. The same goes for the constraint tags      //
+// described in validation.go. All of the tags are precomputed into rules.    //
 ////////////////////////////////////////////////////////////////////////////////
 type modelIn struct {
-	model          interface{}
-	requiredFields [][]int
-	roFields       [][]int
+	model interface{}
+	rules *structRules
 }
 
 ////////////////////////////////////////////////////////////////////////////////
-// The data model of the response body. This is set using the Call.Returns()  //
-// method. The model must be a struct, and sleepy will identify all of fields //
-// that are tagged with tags that are relevant to input (writeonly, hidden))  //
-// Sleepy tags on the model are enforced, so if a modelOut field is taged as  //
-// writeonly then that field will be zero'd in the response before it is sent //
-// to the client.                                                             //
+// The data model of a response body. This is set using the Call.Returns()    //
+// method, or ReturnsStatus() for other statuses than 200. The model must be  //
+// a struct, or a slice, array or map of them, e.g. []User{}, and sleepy will //
+// identify all of fields that are tagged with tags that are relevant to      //
+// output (writeonly, hidden). Those fields are zero'd in every response      //
+// before it is sent to the client, wherever the model appears in it, see     //
+// scrub. A nil model is a response without a body.                           //
 ////////////////////////////////////////////////////////////////////////////////
 type modelOut struct {
-	model        interface{}
-	woFields     [][]int
-	hiddenFields [][]int
+	status int
+	model  interface{}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // inputVar represents an input to the call that is not part of the request   //
 // body. These may be URL path variables, URL query variables, or header      //
-// variables. They are generated using Call builder methods, and their        //
-// properties are currently not enforced, but may be in a later version.      //
+// variables. They are generated using Call builder methods. The type and     //
+// constraints of every variable are enforced before the call filters run,    //
+// and the parsed values are made available through CallData.Params().        //
 ////////////////////////////////////////////////////////////////////////////////
 type inputVar struct {
 	typ      string
 	name     string
 	desc     string
 	required bool
+	def      *string
+	min      *int
+	max      *int
+	pattern  *regexp.Regexp
+	enum     []string
 }
 
 ////////////////////////////////////////////////////////////////////////////////
-// Function responsible for identifying all sleepy field tags that are        //
-// relevant to request body (required, readonly). It uses a recursive         //
-// strategy to read all tags of fields in embeded structs. The discovered     //
-// field indices are stored in their respective  slices in modelIn.           //
-////////////////////////////////////////////////////////////////////////////////
-func (cdm *callDataModel) identifyFieldTagsIn(pos []int) {
-	var curType reflect.Type
-	if pos == nil {
-		curType = reflect.TypeOf(cdm.bodyIn.model)
-	} else {
-		curType = reflect.TypeOf(cdm.bodyIn.model).FieldByIndex(pos).Type
-	}
-	// assert that kind at pos is struct
-	if curType.Kind() != reflect.Struct {
-		log.Critical("The kind at pos is not a struct")
-	}
-	for curPos := 0; curPos < curType.NumField(); curPos++ {
-		tags := strings.Split(curType.Field(curPos).Tag.Get("sleepy"), ",")
-		for _, tag := range tags {
-			switch tag {
-			case sleepyRequired:
-				cdm.bodyIn.requiredFields = append(cdm.bodyIn.requiredFields, append(pos, curPos))
-			case sleepyReadOnly:
-				cdm.bodyIn.roFields = append(cdm.bodyIn.roFields, append(pos, curPos))
-			}
-		}
-		// recursive call
-		if curType.Field(curPos).Type.Kind() == reflect.Struct {
-			cdm.identifyFieldTagsIn(append(pos, curPos))
-		}
+// Function responsible for validating the fields of a payload against the    //
+// sleepy tags of the dataIn data model. Required fields must be present in   //
+// the body and readonly fields must be absent, as told by the present set,   //
+// or by zero values if it is nil. Every constraint tag must hold. Every      //
+// violation is collected and named by its JSON path, so that the client can  //
+// fix all of them in one round trip.                                         //
+////////////////////////////////////////////////////////////////////////////////
+func (cdm *callDataModel) validateTagsIn(payload interface{}, present fieldSet, require bool) *Error {
+	mode := tagMode{require: require, readonly: true, present: present}
+	problems := cdm.bodyIn.rules.validate(reflect.ValueOf(payload), "", mode, nil)
+	if len(problems) == 0 {
+		return nil
 	}
+	return ErrValidation("Failed while validating tags for the payload.", problems, ERR_INVALID_FIELD)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
-// Function responsible for identifying all sleepy field tags that are        //
-// relevant to response body (writeonly, hidden). It uses a recusrive         //
-// strategy to read all tags of fields in embeded structs. The discovered     //
-// field indices are stored in their respective slices in modelOut.           //
-////////////////////////////////////////////////////////////////////////////////
-func (cdm *callDataModel) identifyFieldTagsOut(pos []int) {
-	var curType reflect.Type
-	if pos == nil {
-		curType = reflect.TypeOf(cdm.bodyOut.model)
-	} else {
-		curType = reflect.TypeOf(cdm.bodyOut.model).FieldByIndex(pos).Type
-	}
-	// assert that kind at pos is struct
-	if curType.Kind() != reflect.Struct {
-		log.Info("The kind at pos is not a struct")
-		return
-	}
-	for curPos := 0; curPos < curType.NumField(); curPos++ {
-		tags := strings.Split(curType.Field(curPos).Tag.Get("sleepy"), ",")
-		for _, tag := range tags {
-			switch tag {
-			case sleepyWriteOnly:
-				cdm.bodyOut.woFields = append(cdm.bodyOut.woFields, append(pos, curPos))
-			case sleepyHidden:
-			}
-		}
-		// recursive call
-		if curType.Field(curPos).Type.Kind() == reflect.Struct {
-			cdm.identifyFieldTagsOut(append(pos, curPos))
-		}
-	}
-}
-
-func (cdm *callDataModel) validateQueryVars(r *http.Request, d CallData) *Error {
-	for _, queryVar := range cdm.queryVars {
-		// Check if required vars are missing
-		if queryVar.required && r.FormValue(queryVar.name) == "" {
-			return ErrBadRequest("Failed while validating query variables.", "Required query variable '"+queryVar.name+"' is missing.", ERR_FIELD_MISSING)
-		}
+// A helper function to check if the given variable is an instance of its     //
+// type's zero value.                                                         //
+////////////////////////////////////////////////////////////////////////////////
+func isZero(v reflect.Value) bool {
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Map {
+		return v.Len() == 0
 	}
-	return nil
+	return v.IsZero()
 }
 
 ////////////////////////////////////////////////////////////////////////////////
-// Function responsible for validating the fields of a payload against the    //
-// sleepy tags of the dataIn data model. Loop over all required and readonly  //
-// fields. Ensure that required fields are not zero values, ensure that       //
-// readonly fields ARE zero values.                                           //
-////////////////////////////////////////////////////////////////////////////////
-func (cdm *callDataModel) validateTagsIn(payload interface{}, require bool) *Error {
-	pValue := reflect.ValueOf(payload).Elem()
-	mType := reflect.TypeOf(cdm.bodyIn.model)
-	// Ensure required fields are not zeros
-	// TODO add an exception for bool since default value is false.
-	if require {
-		for _, reqField := range cdm.bodyIn.requiredFields {
-			if isZero(pValue.FieldByIndex(reqField).Interface()) {
-				return ErrBadRequest("Failed while validating tags for the payload.", "Required field: "+mType.FieldByIndex(reqField).Name+" is missing.", ERR_FIELD_MISSING)
-			}
-		}
+// Helper functions for reading the struct tags of model fields. The JSON     //
+// name of a field follows the same rules as encoding/json: unexported fields //
+// and fields tagged with "-" are not marshaled.                              //
+////////////////////////////////////////////////////////////////////////////////
+func jsonFieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" && !f.Anonymous {
+		return "", false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
 	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name, true
+	}
+	return f.Name, true
+}
 
-	// Ensure read only fields are not present
-	for _, roField := range cdm.bodyIn.roFields {
-		if !isZero(pValue.FieldByIndex(roField).Interface()) {
-			return ErrBadRequest("Failed while validating tags for the payload.", "Attempting to set read-only field: "+mType.FieldByIndex(roField).Name+".", ERR_MOD_RO_FIELD)
+func hasJSONOption(f reflect.StructField, option string) bool {
+	opts := strings.Split(f.Tag.Get("json"), ",")
+	for _, opt := range opts[1:] {
+		if opt == option {
+			return true
 		}
 	}
-	return nil
+	return false
 }
 
-////////////////////////////////////////////////////////////////////////////////
-// A helper function to check if the given variable is an instance of its     //
-// type's zero value.                                                         //
-////////////////////////////////////////////////////////////////////////////////
-func isZero(x interface{}) bool {
-	if reflect.TypeOf(x).Kind() == reflect.Slice {
-		log.Info("The object is a slice.")
-		if reflect.ValueOf(x).Len() == 0 {
+func hasSleepyTag(f reflect.StructField, tag string) bool {
+	for _, item := range parseSleepyTag(f.Tag.Get("sleepy")) {
+		if item[0] == tag {
 			return true
-		} else {
-			return false
 		}
-	} else {
-		return x == reflect.Zero(reflect.TypeOf(x)).Interface()
 	}
+	return false
 }
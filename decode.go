@@ -0,0 +1,224 @@
+package sleepy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// Options for reading request bodies. They can be set for the whole API and  //
+// replaced for single calls. The zero value reads bodies like before:        //
+//                                                                            //
+// - MaxBytes:              The largest body that is read. Larger bodies are  //
+//                          answered with a 413. Zero means no limit.         //
+// - DisallowUnknownFields: Reject objects with fields that are not in the    //
+//                          model.                                            //
+// - DisallowTrailingData:  Reject anything but whitespace after the body.    //
+// - UseNumber:             Decode numbers into interface{} values of the     //
+//                          model as json.Number instead of float64.          //
+//                                                                            //
+// MaxBytes applies to every codec. The other options are honored by the      //
+// JSON and MessagePack codecs, and by any codec implementing OptionsDecoder. //
+////////////////////////////////////////////////////////////////////////////////
+type DecodeOptions struct {
+	MaxBytes              int64
+	DisallowUnknownFields bool
+	DisallowTrailingData  bool
+	UseNumber             bool
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// A Codec that can honor DecodeOptions. Decode errors that should get their  //
+// own error code are UnknownFieldError and ErrTrailingData.                  //
+////////////////////////////////////////////////////////////////////////////////
+type OptionsDecoder interface {
+	DecodeWithOptions(r io.Reader, v interface{}, opts DecodeOptions) error
+}
+
+// Returned by codecs when data follows the body and DisallowTrailingData is set.
+var ErrTrailingData = errors.New("unexpected data after the request body")
+
+// Returned by codecs when a body contains a field that is not in the model and
+// DisallowUnknownFields is set.
+type UnknownFieldError struct {
+	Field string
+}
+
+func (e *UnknownFieldError) Error() string {
+	return "unknown field '" + e.Field + "'"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Set the DecodeOptions of every call of the API that doesn't have its own.  //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) DecodeOptions(opts DecodeOptions) {
+	api.decodeOptions = opts
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Set the DecodeOptions of the call, replacing those of the API.             //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) DecodeOptions(opts DecodeOptions) *Call {
+	c.decodeOpts = &opts
+	return c
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Read the request body into payload with the codec, applying the decode     //
+// options of the call. Each way that decoding can fail gets its own error.   //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) decodeBody(w http.ResponseWriter, r *http.Request, codec Codec, payload interface{}) *Error {
+	opts := c.decodeOptions()
+	body := bodyReader(w, r, opts)
+	var err error
+	if od, ok := codec.(OptionsDecoder); ok {
+		err = od.DecodeWithOptions(body, payload, opts)
+	} else {
+		err = codec.Decode(body, payload)
+	}
+	if err == nil {
+		return nil
+	}
+	return decodeError(err)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Read the request body into payload like decodeBody, and record which       //
+// fields of the model were present in it. The JSON and MessagePack codecs    //
+// can tell, for other codecs the returned set is nil and validation falls    //
+// back to treating zero values as missing.                                   //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) decodeModel(w http.ResponseWriter, r *http.Request, codec Codec, payload interface{}) (fieldSet, *Error) {
+	td, ok := codec.(treeDecoder)
+	if !ok {
+		return nil, c.decodeBody(w, r, codec, payload)
+	}
+	opts := c.decodeOptions()
+	tree, err := td.decodeTree(bodyReader(w, r, opts), opts)
+	if err == nil {
+		err = decodeTree(tree, payload, opts)
+	}
+	if err != nil {
+		return nil, decodeError(err)
+	}
+	present := make(fieldSet)
+	(&presenceWalk{present: present}).value(reflect.TypeOf(payload), "", tree)
+	return present, nil
+}
+
+// A codec that reads bodies into the generic tree of encoding/json first, so
+// that the keys of the body can be seen before it is decoded into the model.
+type treeDecoder interface {
+	decodeTree(r io.Reader, opts DecodeOptions) (interface{}, error)
+}
+
+// decodeTree decodes the generic tree of a body into v.
+func decodeTree(tree interface{}, v interface{}, opts DecodeOptions) error {
+	jb, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	return jsonCodec{}.DecodeWithOptions(bytes.NewReader(jb), v, DecodeOptions{
+		DisallowUnknownFields: opts.DisallowUnknownFields,
+		UseNumber:             opts.UseNumber,
+	})
+}
+
+// bodyReader returns the body of the request, limited to opts.MaxBytes.
+func bodyReader(w http.ResponseWriter, r *http.Request, opts DecodeOptions) io.Reader {
+	if opts.MaxBytes > 0 {
+		return http.MaxBytesReader(w, r.Body, opts.MaxBytes)
+	}
+	return r.Body
+}
+
+// The decode options of the call, or else those of the API.
+func (c *Call) decodeOptions() DecodeOptions {
+	if c.decodeOpts != nil {
+		return *c.decodeOpts
+	}
+	return c.resource.api.decodeOptions
+}
+
+// decodeError turns an error of a codec into the matching Error.
+func decodeError(err error) *Error {
+	var tooLarge *http.MaxBytesError
+	var unknown *UnknownFieldError
+	switch {
+	case errors.As(err, &tooLarge):
+		return ErrRequestTooLarge(tooLarge.Limit)
+	case errors.As(err, &unknown):
+		apiErr := ErrBadRequest(err.Error(), "The request contains the unknown field '"+unknown.Field+"'.", ERR_UNKNOWN_FIELD)
+		apiErr.Fields = []FieldError{{Field: unknown.Field, Rule: "unknown", Message: "Unknown field '" + unknown.Field + "'."}}
+		return apiErr
+	case errors.Is(err, ErrTrailingData):
+		return ErrBadRequest(err.Error(), "The request body must contain a single value.", ERR_TRAILING_DATA)
+	}
+	return ErrBadRequest(err.Error(), "Could not parse the request.", ERR_PARSE_REQUEST)
+}
+
+func (jsonCodec) DecodeWithOptions(r io.Reader, v interface{}, opts DecodeOptions) error {
+	dec := json.NewDecoder(r)
+	if opts.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if opts.UseNumber {
+		dec.UseNumber()
+	}
+	if err := dec.Decode(v); err != nil {
+		return jsonUnknownField(err)
+	}
+	if opts.DisallowTrailingData {
+		if _, err := dec.Token(); err != io.EOF {
+			return ErrTrailingData
+		}
+	}
+	return nil
+}
+
+// jsonUnknownField turns the error encoding/json returns for unknown fields,
+// which has no type of its own, into an UnknownFieldError.
+func jsonUnknownField(err error) error {
+	const prefix = "json: unknown field "
+	if msg := err.Error(); strings.HasPrefix(msg, prefix) {
+		return &UnknownFieldError{Field: strings.Trim(msg[len(prefix):], `"`)}
+	}
+	return err
+}
+
+func (msgpackCodec) DecodeWithOptions(r io.Reader, v interface{}, opts DecodeOptions) error {
+	tree, err := msgpackCodec{}.decodeTree(r, opts)
+	if err != nil {
+		return err
+	}
+	return decodeTree(tree, v, opts)
+}
+
+func (jsonCodec) decodeTree(r io.Reader, opts DecodeOptions) (interface{}, error) {
+	var tree interface{}
+	err := jsonCodec{}.DecodeWithOptions(r, &tree, DecodeOptions{
+		DisallowTrailingData: opts.DisallowTrailingData,
+		UseNumber:            true,
+	})
+	return tree, err
+}
+
+func (msgpackCodec) decodeTree(r io.Reader, opts DecodeOptions) (interface{}, error) {
+	br := bufio.NewReader(r)
+	tree, err := readMsgpack(br, 0)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DisallowTrailingData {
+		if _, err := br.ReadByte(); err != io.EOF {
+			return nil, ErrTrailingData
+		}
+	}
+	return tree, nil
+}
@@ -0,0 +1,50 @@
+package sleepy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDecodeOptions(t *testing.T) {
+	type item struct {
+		Name  string      `json:"name" xml:"name"`
+		Extra interface{} `json:"extra" xml:"-"`
+	}
+	// The handler tells if a number in Extra was decoded as a json.Number
+	kind := func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+		w.Header().Set("X-Extra", fmt.Sprintf("%T", d.Body().(*item).Extra))
+		return d.Body(), nil
+	}
+	res := NewResource("/items")
+	res.Route("").Method("POST").Reads(item{}).Returns(item{}).To(kind)
+	res.Route("/lenient").Method("POST").Reads(item{}).Returns(item{}).DecodeOptions(DecodeOptions{}).To(kind)
+	api := New("/api", false)
+	api.DecodeOptions(DecodeOptions{MaxBytes: 64, DisallowUnknownFields: true, DisallowTrailingData: true, UseNumber: true})
+	register(t, api, res)
+
+	post := func(title, url, body, contentType string, status int, check responseCheck) httpCase {
+		return httpCase{title: title, method: "POST", url: "/api/items" + url, body: body, headers: []string{"Content-Type", contentType}, status: status, check: check}
+	}
+	errorCode := func(code int) responseCheck {
+		return hasJSON("code", float64(code))
+	}
+	large := `{"name": "` + strings.Repeat("a", 64) + `"}`
+	runCases(t, api, []httpCase{
+		post("valid", "", `{"name": "a", "extra": 1}`, "application/json", http.StatusOK, hasHeader("X-Extra", "json.Number")),
+		post("too large", "", large, "application/json", http.StatusRequestEntityTooLarge, nil),
+		post("too large xml", "", `<item><name>`+strings.Repeat("a", 64)+`</name></item>`, "application/xml", http.StatusRequestEntityTooLarge, nil),
+		post("too large msgpack", "", "\x81\xa4name\xd9\x40"+strings.Repeat("a", 64), "application/msgpack", http.StatusRequestEntityTooLarge, nil),
+		post("unknown field", "", `{"name": "a", "nick": "b"}`, "application/json", http.StatusUnprocessableEntity,
+			all(errorCode(ERR_UNKNOWN_FIELD), hasFieldErrors("nick:unknown"))),
+		post("unknown field in msgpack", "", "\x81\xa4nick\xa1b", "application/msgpack", http.StatusUnprocessableEntity, errorCode(ERR_UNKNOWN_FIELD)),
+		post("trailing data", "", `{"name": "a"} {}`, "application/json", http.StatusUnprocessableEntity, errorCode(ERR_TRAILING_DATA)),
+		post("trailing whitespace", "", "{\"name\": \"a\"}\n\t ", "application/json", http.StatusOK, nil),
+		post("trailing data in msgpack", "", "\x81\xa4name\xa1a\xc0", "application/msgpack", http.StatusUnprocessableEntity, errorCode(ERR_TRAILING_DATA)),
+		post("malformed", "", `{"name": `, "application/json", http.StatusUnprocessableEntity, errorCode(ERR_PARSE_REQUEST)),
+
+		// The options of the call replace those of the API
+		post("call options", "/lenient", large[:len(large)-2]+`", "nick": "b", "extra": 1} {}`, "application/json", http.StatusOK, hasHeader("X-Extra", "float64")),
+	})
+}
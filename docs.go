@@ -0,0 +1,54 @@
+package sleepy
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// Serve the OpenAPI document of the API and an interactive page that lists   //
+// every resource and call at the given path. The page is self-contained, all //
+// of its scripts and styles are embedded in the binary, so it works without  //
+// access to the internet. This is opt-in, nothing is served until ServeDocs  //
+// is called.                                                                 //
+//                                                                            //
+// The docs are registered on the same router as the API resources, so with   //
+// a base path of /v2, ServeDocs("/docs") serves:                             //
+//                                                                            //
+//   GET /v2/docs               the interactive explorer                      //
+//   GET /v2/docs/openapi.json  the OpenAPI document as JSON                  //
+//   GET /v2/docs/openapi.yaml  the OpenAPI document as YAML                  //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) ServeDocs(path string) {
+	path = "/" + strings.Trim(path, "/")
+	specURL := api.basePath + path + "/openapi.json"
+
+	api.resourceRouter.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		d := DataFromContext(r.Context())
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(strings.Replace(docsHTML, "{{SPEC_URL}}", template.JSEscapeString(specURL), 1)))
+		api.endCall(w, r, nil, d)
+	}).Methods("GET")
+
+	api.resourceRouter.HandleFunc(path+"/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		d := DataFromContext(r.Context())
+		api.serveSpec(w, r, d, "application/json", api.OpenAPI)
+	}).Methods("GET")
+
+	api.resourceRouter.HandleFunc(path+"/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		d := DataFromContext(r.Context())
+		api.serveSpec(w, r, d, "application/yaml", api.OpenAPIYAML)
+	}).Methods("GET")
+}
+
+func (api *API) serveSpec(w http.ResponseWriter, r *http.Request, d CallData, contentType string, build func() ([]byte, error)) {
+	spec, err := build()
+	if err != nil {
+		api.endCall(w, r, ErrInternal("Could not build the OpenAPI document: "+err.Error()), d)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(spec)
+	api.endCall(w, r, nil, d)
+}
@@ -0,0 +1,328 @@
+package sleepy
+
+////////////////////////////////////////////////////////////////////////////////
+// The page served by ServeDocs. It loads the OpenAPI document of the API     //
+// from {{SPEC_URL}}, which is replaced when the page is served, and renders  //
+// it without any external scripts or styles.                                 //
+////////////////////////////////////////////////////////////////////////////////
+const docsHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>API Reference</title>
+<style>
+body { margin: 0; font: 14px/1.5 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #222; background: #f6f7f9; }
+header { background: #263238; color: #fff; padding: 16px 32px; }
+header h1 { margin: 0; font-size: 22px; }
+header p { margin: 4px 0 0; color: #b0bec5; }
+main { max-width: 1100px; margin: 0 auto; padding: 16px 32px 64px; }
+h2 { border-bottom: 1px solid #ddd; padding-bottom: 4px; margin-top: 32px; }
+h4 { margin: 16px 0 6px; }
+.op { background: #fff; border: 1px solid #dde1e6; border-radius: 4px; margin: 8px 0; }
+.op > .summary { display: flex; align-items: center; gap: 12px; padding: 8px 12px; cursor: pointer; }
+.op > .details { display: none; border-top: 1px solid #dde1e6; padding: 4px 16px 16px; }
+.op.open > .details { display: block; }
+.method { display: inline-block; min-width: 64px; text-align: center; border-radius: 3px; color: #fff; font-weight: bold; font-size: 12px; padding: 2px 0; }
+.m-get { background: #1e88e5; } .m-post { background: #43a047; } .m-put { background: #fb8c00; }
+.m-patch { background: #8e24aa; } .m-delete { background: #e53935; } .m-other { background: #757575; }
+.path { font-family: Menlo, Consolas, monospace; font-weight: bold; }
+.opid { color: #78909c; margin-left: auto; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; border-bottom: 1px solid #eee; padding: 4px 8px; vertical-align: top; }
+th { font-weight: 600; color: #546e7a; }
+pre { background: #263238; color: #eceff1; padding: 8px 12px; border-radius: 3px; overflow: auto; margin: 4px 0; }
+.req { color: #e53935; }
+.try input, .try textarea { width: 100%; box-sizing: border-box; font-family: Menlo, Consolas, monospace; font-size: 13px; padding: 4px; }
+.try textarea { min-height: 120px; }
+.try label { display: block; margin-top: 8px; font-weight: 600; }
+.try button { margin-top: 12px; padding: 6px 20px; background: #263238; color: #fff; border: 0; border-radius: 3px; cursor: pointer; }
+.status { font-weight: bold; margin-top: 12px; }
+.error { color: #e53935; }
+</style>
+</head>
+<body>
+<header><h1 id="title">API Reference</h1><p id="description"></p></header>
+<main id="content"><p>Loading&hellip;</p></main>
+<script>
+(function () {
+	"use strict";
+	var specURL = "{{SPEC_URL}}";
+	var spec;
+
+	function el(tag, attrs, children) {
+		var node = document.createElement(tag);
+		attrs = attrs || {};
+		for (var key in attrs) {
+			if (key === "text") {
+				node.textContent = attrs[key];
+			} else if (key === "onclick") {
+				node.addEventListener("click", attrs[key]);
+			} else {
+				node.setAttribute(key, attrs[key]);
+			}
+		}
+		(children || []).forEach(function (child) {
+			if (child) {
+				node.appendChild(child);
+			}
+		});
+		return node;
+	}
+
+	function resolve(schema) {
+		var seen = 0;
+		while (schema && schema.$ref && seen++ < 32) {
+			schema = spec.components.schemas[schema.$ref.split("/").pop()];
+		}
+		if (schema && schema.allOf && schema.allOf.length === 1) {
+			var inner = resolve(schema.allOf[0]);
+			var merged = {};
+			for (var k in inner) { merged[k] = inner[k]; }
+			merged.readOnly = schema.readOnly;
+			merged.writeOnly = schema.writeOnly;
+			return merged;
+		}
+		return schema || {};
+	}
+
+	function typeName(schema) {
+		var name = schema.$ref ? schema.$ref.split("/").pop() : "";
+		schema = resolve(schema);
+		if (!name) {
+			name = schema.type || "any";
+			if (schema.type === "array" && schema.items) {
+				name = typeName(schema.items) + "[]";
+			}
+			if (schema.format) {
+				name += " (" + schema.format + ")";
+			}
+		}
+		return name;
+	}
+
+	// Build an example value for a schema. Read only fields are left out of
+	// requests and write only fields are left out of responses.
+	function example(schema, forRequest, depth) {
+		schema = resolve(schema);
+		if ((depth || 0) > 6) {
+			return null;
+		}
+		if (schema.example !== undefined) {
+			return schema.example;
+		}
+		if (schema["enum"]) {
+			return schema["enum"][0];
+		}
+		if (schema["default"] !== undefined) {
+			return schema["default"];
+		}
+		switch (schema.type) {
+		case "object":
+			var obj = {};
+			var props = schema.properties || {};
+			Object.keys(props).forEach(function (name) {
+				var prop = resolve(props[name]);
+				if ((forRequest && prop.readOnly) || (!forRequest && prop.writeOnly)) {
+					return;
+				}
+				obj[name] = example(props[name], forRequest, (depth || 0) + 1);
+			});
+			return obj;
+		case "array":
+			return schema.items ? [example(schema.items, forRequest, (depth || 0) + 1)] : [];
+		case "integer":
+		case "number":
+			return schema.minimum !== undefined ? schema.minimum : 0;
+		case "boolean":
+			return false;
+		case "string":
+			if (schema.format === "date-time") {
+				return new Date(0).toISOString();
+			}
+			if (schema.format === "uuid") {
+				return "00000000-0000-0000-0000-000000000000";
+			}
+			return "string";
+		}
+		return null;
+	}
+
+	function schemaBlock(schema, forRequest) {
+		return el("div", {}, [
+			el("div", {text: "Model: " + typeName(schema)}),
+			el("pre", {text: JSON.stringify(example(schema, forRequest), null, 2)})
+		]);
+	}
+
+	function jsonContent(content) {
+		if (!content) {
+			return null;
+		}
+		var types = Object.keys(content);
+		return types.length ? content[types[0]].schema : null;
+	}
+
+	function paramsTable(params) {
+		var rows = params.map(function (p) {
+			return el("tr", {}, [
+				el("td", {}, [el("code", {text: p.name}), p.required ? el("span", {"class": "req", text: " *"}) : null]),
+				el("td", {text: p["in"]}),
+				el("td", {text: p.schema ? typeName(p.schema) : ""}),
+				el("td", {text: p.description || ""})
+			]);
+		});
+		return el("table", {}, [
+			el("tr", {}, ["Name", "In", "Type", "Description"].map(function (h) { return el("th", {text: h}); }))
+		].concat(rows));
+	}
+
+	function tryIt(path, method, op) {
+		var params = op.parameters || [];
+		var inputs = {};
+		var form = el("div", {"class": "try"});
+		params.forEach(function (p) {
+			inputs[p.name] = el("input", {placeholder: p["in"] + " parameter"});
+			form.appendChild(el("label", {text: p.name + (p.required ? " *" : "")}));
+			form.appendChild(inputs[p.name]);
+		});
+		var headers = el("textarea", {placeholder: "Authorization: Bearer ...", style: "min-height: 48px"});
+		form.appendChild(el("label", {text: "Headers (one per line)"}));
+		form.appendChild(headers);
+		var body = null;
+		var bodySchema = op.requestBody ? jsonContent(op.requestBody.content) : null;
+		if (bodySchema) {
+			body = el("textarea");
+			body.value = JSON.stringify(example(bodySchema, true), null, 2);
+			form.appendChild(el("label", {text: "Body"}));
+			form.appendChild(body);
+		}
+		var status = el("div", {"class": "status"});
+		var output = el("pre", {style: "display: none"});
+		form.appendChild(el("button", {text: "Send", onclick: function () {
+			var url = path;
+			var query = [];
+			params.forEach(function (p) {
+				var value = inputs[p.name].value;
+				if (p["in"] === "path") {
+					url = url.replace("{" + p.name + "}", encodeURIComponent(value));
+				} else if (value !== "") {
+					query.push(encodeURIComponent(p.name) + "=" + encodeURIComponent(value));
+				}
+			});
+			if (query.length) {
+				url += "?" + query.join("&");
+			}
+			var init = {method: method.toUpperCase(), headers: {}};
+			headers.value.split("\n").forEach(function (line) {
+				var i = line.indexOf(":");
+				if (i > 0) {
+					init.headers[line.slice(0, i).trim()] = line.slice(i + 1).trim();
+				}
+			});
+			if (body) {
+				init.headers["Content-Type"] = init.headers["Content-Type"] || "application/json";
+				init.body = body.value;
+			}
+			var started = Date.now();
+			status.className = "status";
+			status.textContent = "Sending " + init.method + " " + url + "…";
+			fetch(url, init).then(function (resp) {
+				return resp.text().then(function (text) {
+					status.textContent = resp.status + " " + resp.statusText + " (" + (Date.now() - started) + " ms)";
+					try {
+						text = JSON.stringify(JSON.parse(text), null, 2);
+					} catch (e) {}
+					output.textContent = text;
+					output.style.display = text ? "block" : "none";
+				});
+			}).catch(function (err) {
+				status.className = "status error";
+				status.textContent = String(err);
+				output.style.display = "none";
+			});
+		}}));
+		form.appendChild(status);
+		form.appendChild(output);
+		return form;
+	}
+
+	function operation(path, method, op) {
+		var cls = "m-" + (["get", "post", "put", "patch", "delete"].indexOf(method) >= 0 ? method : "other");
+		var details = el("div", {"class": "details"});
+		var node = el("div", {"class": "op"}, [
+			el("div", {"class": "summary", onclick: function () { node.classList.toggle("open"); }}, [
+				el("span", {"class": "method " + cls, text: method.toUpperCase()}),
+				el("span", {"class": "path", text: path}),
+				el("span", {"class": "opid", text: op.operationId || ""})
+			]),
+			details
+		]);
+		if (op.parameters && op.parameters.length) {
+			details.appendChild(el("h4", {text: "Parameters"}));
+			details.appendChild(paramsTable(op.parameters));
+		}
+		var bodySchema = op.requestBody ? jsonContent(op.requestBody.content) : null;
+		if (bodySchema) {
+			details.appendChild(el("h4", {text: "Request body"}));
+			details.appendChild(schemaBlock(bodySchema, true));
+		}
+		details.appendChild(el("h4", {text: "Responses"}));
+		Object.keys(op.responses || {}).sort().forEach(function (code) {
+			var resp = op.responses[code];
+			var schema = jsonContent(resp.content);
+			details.appendChild(el("div", {}, [
+				el("strong", {text: code + " "}),
+				el("span", {text: resp.description || ""}),
+				schema ? schemaBlock(schema, false) : null
+			]));
+		});
+		details.appendChild(el("h4", {text: "Try it"}));
+		details.appendChild(tryIt(path, method, op));
+		return node;
+	}
+
+	function render() {
+		document.title = spec.info.title + " Reference";
+		document.getElementById("title").textContent = spec.info.title + " " + spec.info.version;
+		document.getElementById("description").textContent = spec.info.description || "";
+		var content = document.getElementById("content");
+		content.textContent = "";
+
+		var groups = {};
+		var order = [];
+		Object.keys(spec.paths).sort().forEach(function (path) {
+			Object.keys(spec.paths[path]).forEach(function (method) {
+				var op = spec.paths[path][method];
+				var tag = (op.tags && op.tags[0]) || "default";
+				if (!groups[tag]) {
+					groups[tag] = [];
+					order.push(tag);
+				}
+				groups[tag].push(operation(path, method, op));
+			});
+		});
+		order.forEach(function (tag) {
+			content.appendChild(el("h2", {text: tag}));
+			groups[tag].forEach(function (node) { content.appendChild(node); });
+		});
+	}
+
+	fetch(specURL).then(function (resp) {
+		if (!resp.ok) {
+			throw new Error("Could not load " + specURL + ": " + resp.status);
+		}
+		return resp.json();
+	}).then(function (doc) {
+		spec = doc;
+		render();
+	}).catch(function (err) {
+		var content = document.getElementById("content");
+		content.textContent = "";
+		content.appendChild(el("p", {"class": "error", text: String(err)}));
+	});
+})();
+</script>
+</body>
+</html>
+`
@@ -1,35 +1,177 @@
 package sleepy
 
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// Handlers and filters may return any error. Errors that implement HTTPError //
+// (also when wrapped) decide their own status code and the body that is sent //
+// to the client. Any other error is logged and sent to the client as a 500   //
+// without any details, so internal errors never leak to clients.             //
+////////////////////////////////////////////////////////////////////////////////
+type HTTPError interface {
+	error
+	StatusCode() int
+	Body() interface{}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// A function that writes an HTTPError to the client. It is used for every    //
+// error of the API, including the errors that sleepy creates itself. Use     //
+// API.RenderErrors to replace the default renderer.                          //
+////////////////////////////////////////////////////////////////////////////////
+type ErrorRenderer func(http.ResponseWriter, *http.Request, HTTPError)
+
+////////////////////////////////////////////////////////////////////////////////
+// The default ErrorRenderer. It writes the Body of the error as JSON.        //
+////////////////////////////////////////////////////////////////////////////////
+func RenderJSONError(w http.ResponseWriter, r *http.Request, e HTTPError) {
+	// Marshal the error into JSON
+	jb, err := json.Marshal(e.Body())
+	if err != nil {
+		log.Critical("%s", err.Error())
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "Application/JSON")
+	w.WriteHeader(e.StatusCode())
+	w.Write(jb)
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // The error type used by the sleepy library. In the event of an error, this  //
 // struct will be used to log the error and write a response to the client.   //
-//                                                                            //
-// Unfortunately this restricts the errors of sleepy users, as their API      //
-// error system must conform to sleepy's error type.                          //
+// It implements HTTPError, and users are free to use it for their own        //
+// errors as well.                                                            //
 //                                                                            //
 // Sleepy also defines some API error codes that are expected to be used by   //
 // the library user in addition to their own custom codes.                    //
-//                                                                            //
-// In in a later version this should be redesigned to give the user           //
-// more control over they error system.                                       //
 ////////////////////////////////////////////////////////////////////////////////
 type Error struct {
-	HttpCode int    `json:"-"`
-	Err      string `json:"error"`
-	Msg      string `json:"message"`
-	Code     int    `json:"code"`
+	HttpCode int          `json:"-"`
+	Err      string       `json:"error"`
+	Msg      string       `json:"message"`
+	Code     int          `json:"code"`
+	Fields   []FieldError `json:"fields,omitempty"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// A single problem with one field or parameter of a request. Field is the    //
+// name the client used to send the value, and Rule is the constraint that    //
+// was violated, e.g. "required", "type" or "max".                            //
+////////////////////////////////////////////////////////////////////////////////
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
 }
 
 func (this *Error) Error() string {
 	return this.Err
 }
 
+func (this *Error) StatusCode() int {
+	return this.HttpCode
+}
+
+func (this *Error) Body() interface{} {
+	return this
+}
+
+// The error that is sent in place of errors that don't implement HTTPError.
+var errHidden = &Error{HttpCode: 500, Err: "Internal server error.", Code: ERR_INTERNAL}
+
+// errorStatus returns the status code that an error is sent with.
+func errorStatus(err error) int {
+	var httpErr HTTPError
+	if !errors.As(err, &httpErr) {
+		return errHidden.StatusCode()
+	}
+	return httpErr.StatusCode()
+}
+
+// nilIfTypedNil turns a nil pointer stored in an error interface, such as a
+// nil *Error returned by a handler, into a real nil error.
+func nilIfTypedNil(err error) error {
+	if err == nil {
+		return nil
+	}
+	if v := reflect.ValueOf(err); v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+	return err
+}
+
 func ErrInternal(err string) *Error {
-	return &Error{500, err, "", ERR_INTERNAL}
+	return &Error{HttpCode: 500, Err: err, Code: ERR_INTERNAL}
 }
 
 func ErrBadRequest(err string, msg string, code int) *Error {
-	return &Error{422, err, msg, code}
+	return &Error{HttpCode: 422, Err: err, Msg: msg, Code: code}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Create a 422 error that lists every problem that was found in a request.   //
+// If all of the problems are missing fields, or all of them are read-only    //
+// fields that were set, the matching specific code is used instead of code.  //
+////////////////////////////////////////////////////////////////////////////////
+func ErrValidation(err string, fields []FieldError, code int) *Error {
+	msgs := make([]string, len(fields))
+	rules := make(map[string]bool)
+	for i, f := range fields {
+		msgs[i] = f.Message
+		rules[f.Rule] = true
+	}
+	if len(rules) == 1 && rules[sleepyRequired] {
+		code = ERR_FIELD_MISSING
+	} else if len(rules) == 1 && rules[sleepyReadOnly] {
+		code = ERR_MOD_RO_FIELD
+	}
+	apiErr := ErrBadRequest(err, strings.Join(msgs, " "), code)
+	apiErr.Fields = fields
+	return apiErr
+}
+
+func ErrNotFound(path string) *Error {
+	return &Error{HttpCode: 404, Err: "Nothing was found at " + path + ".", Code: ERR_NOT_FOUND}
+}
+
+func ErrMethodNotAllowed(method string) *Error {
+	return &Error{HttpCode: 405, Err: "Method " + method + " is not allowed.", Code: ERR_METHOD_NOT_ALLOWED}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Create a 503 error for a call whose context passed its deadline before the //
+// handler finished.                                                          //
+////////////////////////////////////////////////////////////////////////////////
+func ErrTimeout(operation string) *Error {
+	return &Error{HttpCode: 503, Err: "The call " + operation + " timed out.", Code: ERR_TIMEOUT}
+}
+
+func ErrUnsupportedMediaType(contentType string) *Error {
+	return &Error{HttpCode: 415, Err: "The content type '" + contentType + "' is not supported.", Code: ERR_UNSUPPORTED_MEDIA_TYPE}
+}
+
+func ErrNotAcceptable(accept string) *Error {
+	return &Error{HttpCode: 406, Err: "None of the accepted media types '" + accept + "' can be produced.", Code: ERR_NOT_ACCEPTABLE}
+}
+
+func ErrRequestTooLarge(limit int64) *Error {
+	return &Error{HttpCode: 413, Err: "The request body is larger than " + strconv.FormatInt(limit, 10) + " bytes.", Code: ERR_REQUEST_TOO_LARGE}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Create a 401 error for a request that no security scheme of the call could //
+// authenticate. The WWW-Authenticate header is set by the call itself.       //
+////////////////////////////////////////////////////////////////////////////////
+func ErrUnauthorized(reason string) *Error {
+	return &Error{HttpCode: 401, Err: "The request could not be authenticated.", Msg: reason, Code: ERR_UNAUTHORIZED}
 }
 
 const (
@@ -37,4 +179,17 @@ const (
 	ERR_PARSE_REQUEST
 	ERR_FIELD_MISSING
 	ERR_MOD_RO_FIELD
+	ERR_INVALID_PARAM
+	ERR_INVALID_FIELD
+	ERR_METHOD_NOT_ALLOWED
+	ERR_NOT_FOUND
+	ERR_TIMEOUT
+	ERR_UNSUPPORTED_MEDIA_TYPE
+	ERR_NOT_ACCEPTABLE
+	ERR_REQUEST_TOO_LARGE
+	ERR_UNKNOWN_FIELD
+	ERR_TRAILING_DATA
+	ERR_INVALID_PATCH
+	ERR_PATCH_FAILED
+	ERR_UNAUTHORIZED
 )
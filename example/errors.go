@@ -17,6 +17,10 @@ func (e *Error) StatusCode() int {
 	return e.responseCode
 }
 
+func (e *Error) Body() interface{} {
+	return map[string]string{"message": e.message}
+}
+
 var (
 	ErrInternal      = &Error{responseCode: 500, message: "Server error."}
 	ErrLogin         = &Error{responseCode: 401, message: "Please login."}
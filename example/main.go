@@ -4,22 +4,34 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/tortis/sleepy"
 )
 
 func main() {
 	// Create a new API
-	api := sleepy.New("/v2")
+	api := sleepy.New("/v2", false)
+
+	// Users are created with a JWT signed by the auth service
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		log.Fatal("JWT_SECRET must be set to the secret that signs the tokens")
+	}
+	api.SecurityScheme("bearer", sleepy.NewJWTVerifier(sleepy.JWTConfig{
+		Keys: map[string]interface{}{"": []byte(secret)},
+	}))
 
 	// Init user resource
 	userRes := UserResource{}
-	api.Register(userRes.Generate())
+	if err := api.Register(userRes.Generate()); err != nil {
+		log.Fatal(err)
+	}
 	//api.Filter(apiLogFilter)
 	log.Fatal(http.ListenAndServe(":3000", api))
 }
 
-func apiLogFilter(w http.ResponseWriter, r *http.Request, d map[string]interface{}) error {
+func apiLogFilter(r *http.Request, d sleepy.CallData) error {
 	fmt.Printf("REQUEST: [client %s] to [%s] %s\n", r.RemoteAddr, r.Method, r.URL)
 	return nil
 }
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
 
 	"github.com/tortis/sleepy"
@@ -17,12 +19,13 @@ type User struct {
 }
 
 type UserResource struct {
-	dbs int
+	dbs     int
+	getCall *sleepy.Call
 }
 
 func (u *UserResource) Generate() *sleepy.Resource {
 	res := sleepy.NewResource("/users")
-	res.Route("/{uid}").
+	u.getCall = res.Route("/{uid}").
 		Method("GET").
 		To(u.getUser).
 		OperationName("getUser").
@@ -32,25 +35,30 @@ func (u *UserResource) Generate() *sleepy.Resource {
 	res.Route("").
 		Method("POST").
 		To(u.createUser).
-		Filter(hasAuthFilter).
+		Security("bearer").
 		OperationName("createUser").
 		Reads(User{}).
-		Returns(User{})
+		ReturnsStatus(201, User{})
+
+	sleepy.Handle(res.Route("").Method("GET").OperationName("listUsers"), u.listUsers)
 	return res
 }
 
-func (u *UserResource) getUser(w http.ResponseWriter, r *http.Request, d sleepy.CallData) (interface{}, sleepy.Error) {
-	return fmt.Sprintf("getUser! - %s", "asdf"), nil
+func (u *UserResource) getUser(w http.ResponseWriter, r *http.Request, d sleepy.CallData) (interface{}, error) {
+	return fmt.Sprintf("getUser! - %s", d.Params().String("uid")), nil
 }
 
-func (u *UserResource) createUser(w http.ResponseWriter, r *http.Request, d sleepy.CallData) (interface{}, sleepy.Error) {
-	return "Create User!", nil
+func (u *UserResource) createUser(w http.ResponseWriter, r *http.Request, d sleepy.CallData) (interface{}, error) {
+	user := d.Body().(*User)
+	user.Id = "asdf"
+	log.Printf("user created by %s", d.Principal().Subject)
+	location, err := u.getCall.URL("uid", user.Id)
+	if err != nil {
+		return nil, err
+	}
+	return sleepy.Created(location.String(), user), nil
 }
 
-func hasAuthFilter(w http.ResponseWriter, r *http.Request, d sleepy.CallData) sleepy.Error {
-	if r.Header.Get("Authorization") == "" {
-		return ErrLogin
-	}
-	d["auth"] = r.Header.Get("Authorization")
-	return nil
+func (u *UserResource) listUsers(ctx context.Context, _ sleepy.NoBody, p sleepy.Params) ([]User, error) {
+	return []User{{Id: "asdf", FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", Password: "secret"}}, nil
 }
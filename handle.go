@@ -0,0 +1,92 @@
+package sleepy
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// The In or Out type of a TypedHandler for calls without a request or        //
+// response body. A call whose handler returns NoBody responds with 204.      //
+////////////////////////////////////////////////////////////////////////////////
+type NoBody struct{}
+
+////////////////////////////////////////////////////////////////////////////////
+// A handler with typed input and output, see Handle. The context is the      //
+// context of the request, which carries the CallData like it does for a      //
+// Handler, so filters' data and the patch of a PATCH call are still there:   //
+//                                                                            //
+//   d := sleepy.DataFromContext(ctx)                                         //
+////////////////////////////////////////////////////////////////////////////////
+type TypedHandler[In, Out any] func(ctx context.Context, in In, p Params) (Out, error)
+
+////////////////////////////////////////////////////////////////////////////////
+// Set a typed handler for the call. The models of the call are taken from    //
+// the type parameters, so Reads and Returns don't need to be called:         //
+//                                                                            //
+// - In is the Reads() model, a struct or a pointer to one. The request body  //
+//   is decoded and validated into it before fn is called. Use NoBody for     //
+//   calls without a body.                                                    //
+// - Out is the Returns() model, or, if the call declared a 2xx status with   //
+//   ReturnsStatus before, the model of that status. Use NoBody to respond    //
+//   with 204, and Response or *Response to choose the status and headers,    //
+//   in which case the responses are declared with ReturnsStatus as usual.    //
+//                                                                            //
+//   sleepy.Handle(res.Route("").Method("POST"),                              //
+//       func(ctx context.Context, u User, p sleepy.Params) (*User, error) {  //
+//           return store.Create(ctx, u)                                      //
+//       })                                                                   //
+////////////////////////////////////////////////////////////////////////////////
+func Handle[In, Out any](c *Call, fn TypedHandler[In, Out]) *Call {
+	inType := reflect.TypeOf((*In)(nil)).Elem()
+	outType := reflect.TypeOf((*Out)(nil)).Elem()
+
+	if inType != noBodyType {
+		c.Reads(reflect.Zero(indirectType(inType)).Interface())
+	}
+	switch indirectType(outType) {
+	case noBodyType:
+		c.ReturnsNoContent()
+	case responseType:
+	default:
+		if outType.Kind() == reflect.Interface {
+			// Anything can be returned, so there is no model to declare.
+			break
+		}
+		c.ReturnsStatus(c.defaultStatus(), reflect.Zero(indirectType(outType)).Interface())
+	}
+
+	return c.To(func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+		var in In
+		if body := d.Body(); body != nil {
+			in = typedBody[In](body)
+		}
+		out, err := fn(r.Context(), in, d.Params())
+		if err != nil {
+			return nil, err
+		}
+		if v := reflect.ValueOf(out); !v.IsValid() || v.Type() == noBodyType || (v.Kind() == reflect.Ptr && v.IsNil()) {
+			return nil, nil
+		}
+		return out, nil
+	})
+}
+
+var (
+	noBodyType   = reflect.TypeOf(NoBody{})
+	responseType = reflect.TypeOf(Response{})
+)
+
+// typedBody turns the decoded body, a pointer to the Reads() model, into In,
+// which is either the model or a pointer to it.
+func typedBody[In any](body interface{}) In {
+	if in, ok := body.(In); ok {
+		return in
+	}
+	var in In
+	if v := reflect.ValueOf(body); v.Kind() == reflect.Ptr && !v.IsNil() {
+		in, _ = v.Elem().Interface().(In)
+	}
+	return in
+}
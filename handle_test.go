@@ -0,0 +1,119 @@
+package sleepy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+type handleUser struct {
+	ID   string `json:"id"`
+	Name string `json:"name" sleepy:"required"`
+}
+
+func TestHandle(t *testing.T) {
+	res := NewResource("/users")
+	Handle(res.Route("").Method("POST").ReturnsStatus(http.StatusCreated, nil),
+		func(ctx context.Context, u handleUser, p Params) (*handleUser, error) {
+			u.ID = "1"
+			return &u, nil
+		})
+	Handle(res.Route("/{id}").Method("GET").PathParamInt("id", ""),
+		func(ctx context.Context, _ NoBody, p Params) (*handleUser, error) {
+			switch p.Int("id") {
+			case 0:
+				return nil, nil
+			case 404:
+				return nil, ErrNotFound("user")
+			}
+			// The CallData is still in the context
+			return &handleUser{ID: strconv.Itoa(DataFromContext(ctx).Params().Int("id")), Name: "Ann"}, nil
+		})
+	Handle(res.Route("/{id}").Method("PUT"),
+		func(ctx context.Context, u *handleUser, p Params) (handleUser, error) {
+			return *u, nil
+		})
+	Handle(res.Route("/{id}").Method("DELETE"),
+		func(ctx context.Context, _ NoBody, p Params) (NoBody, error) {
+			return NoBody{}, nil
+		})
+	Handle(res.Route("/{id}/raw").Method("GET"),
+		func(ctx context.Context, _ NoBody, p Params) (interface{}, error) {
+			return map[string]string{"raw": "yes"}, nil
+		})
+	Handle(res.Route("/{id}/failed").Method("GET"),
+		func(ctx context.Context, _ NoBody, p Params) (*handleUser, error) {
+			return &handleUser{}, errors.New("hidden")
+		})
+	api := newTestAPI(t, res)
+
+	runCases(t, api, []httpCase{
+		{title: "typed in and out", method: "POST", url: "/api/users", body: `{"name": "Ann"}`, status: http.StatusCreated,
+			check: all(hasJSON("id", "1"), hasJSON("name", "Ann"))},
+		{title: "in is validated", method: "POST", url: "/api/users", body: `{}`, status: http.StatusUnprocessableEntity, check: hasFieldErrors("name:required")},
+		{title: "no body", url: "/api/users/7", status: http.StatusOK, check: hasJSON("id", "7")},
+		{title: "nil out", url: "/api/users/0", status: http.StatusInternalServerError},
+		{title: "error", url: "/api/users/404", status: http.StatusNotFound},
+		{title: "error with out", url: "/api/users/1/failed", status: http.StatusInternalServerError},
+		{title: "pointer in", method: "PUT", url: "/api/users/1", body: `{"id": "1", "name": "Bo"}`, status: http.StatusOK, check: hasJSON("name", "Bo")},
+		{title: "no content", method: "DELETE", url: "/api/users/1", status: http.StatusNoContent},
+		{title: "interface out", url: "/api/users/1/raw", status: http.StatusOK, check: hasJSON("raw", "yes")},
+	})
+
+	// The models of the OpenAPI document are taken from the type parameters
+	b, err := api.OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	type content map[string]struct {
+		Schema struct {
+			Ref string `json:"$ref"`
+		}
+	}
+	var doc struct {
+		Paths map[string]map[string]struct {
+			RequestBody *struct{ Content content }
+			Responses   map[string]struct{ Content content }
+		}
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	const user = "#/components/schemas/handleUser"
+	tests := []struct {
+		path, method string
+		in           string
+		out          map[string]string
+	}{
+		{"/api/users", "post", user, map[string]string{"201": user}},
+		{"/api/users/{id}", "get", "", map[string]string{"200": user}},
+		{"/api/users/{id}", "put", user, map[string]string{"200": user}},
+		{"/api/users/{id}", "delete", "", map[string]string{"204": ""}},
+		{"/api/users/{id}/raw", "get", "", map[string]string{"200": ""}},
+	}
+	for _, test := range tests {
+		op, ok := doc.Paths[test.path][test.method]
+		if !ok {
+			t.Errorf("no operation %s %s", test.method, test.path)
+			continue
+		}
+		in := ""
+		if op.RequestBody != nil {
+			in = op.RequestBody.Content["application/json"].Schema.Ref
+		}
+		out := map[string]string{}
+		for status, resp := range op.Responses {
+			if status == "default" {
+				continue
+			}
+			out[status] = resp.Content["application/json"].Schema.Ref
+		}
+		if in != test.in || !reflect.DeepEqual(out, test.out) {
+			t.Errorf("%s %s: got body %q and responses %v, want %q and %v", test.method, test.path, in, out, test.in, test.out)
+		}
+	}
+}
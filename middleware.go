@@ -0,0 +1,176 @@
+package sleepy
+
+import (
+	"net/http"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// A filter that runs after the call handler. It gets the response that is    //
+// about to be written, with its status resolved, and the error of the        //
+// handler, if any. If there is an error, the status is the one the error     //
+// will be sent with, e.g. 500 for errors that aren't an HTTPError. The       //
+// filter can change the response in place, e.g. add headers or wrap the body //
+// in an envelope. The headers are sent with errors too. A filter that        //
+// recovers from an error sets the status and body of the response to send    //
+// instead. The error it returns replaces the error of the handler, so a      //
+// filter that only looks at the response must return err as it got it:       //
+//                                                                            //
+//   func audit(r *http.Request, d sleepy.CallData, resp *sleepy.Response,    //
+//       err error) error {                                                   //
+//       log.Printf("%s %s: %d %v", r.Method, r.URL, resp.Status, err)        //
+//       return err                                                           //
+//   }                                                                        //
+//                                                                            //
+// After filters only run for requests that reached the call handler, not     //
+// for requests that a Filter stopped before.                                 //
+////////////////////////////////////////////////////////////////////////////////
+type AfterFilter func(r *http.Request, d CallData, resp *Response, err error) error
+
+////////////////////////////////////////////////////////////////////////////////
+// A middleware that wraps the call handler. It can run code around the       //
+// handler, replace its arguments, or inspect and replace its result:         //
+//                                                                            //
+//   func timing(next sleepy.Handler) sleepy.Handler {                        //
+//       return func(w http.ResponseWriter, r *http.Request,                  //
+//           d sleepy.CallData) (interface{}, error) {                        //
+//           start := time.Now()                                              //
+//           result, err := next(w, r, d)                                     //
+//           w.Header().Set("X-Handler-Time", time.Since(start).String())     //
+//           return result, err                                               //
+//       }                                                                    //
+//   }                                                                        //
+//                                                                            //
+// Middleware runs after all of the filters, since the filters of the API     //
+// and the resource run before the call is even matched.                      //
+////////////////////////////////////////////////////////////////////////////////
+type Middleware func(next Handler) Handler
+
+////////////////////////////////////////////////////////////////////////////////
+// Add an after filter to the whole API. These filters run after any call or  //
+// resource after filters, so they see the final response. The filters will   //
+// run in the order that they are added.                                      //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) After(f AfterFilter) {
+	api.after = append(api.after, f)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Add a middleware to every call of the API. The middleware of the API wraps //
+// the middleware of resources and calls, and the middleware added first is   //
+// the outermost.                                                             //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) Wrap(m Middleware) {
+	api.wraps = append(api.wraps, m)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Add an after filter to every call of the resource. These filters run after //
+// the after filters of the call, and before those of the API.                //
+////////////////////////////////////////////////////////////////////////////////
+func (r *Resource) After(f AfterFilter) {
+	r.after = append(r.after, f)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Add a middleware to every call of the resource. It is wrapped by the       //
+// middleware of the API, and wraps the middleware of the calls.              //
+////////////////////////////////////////////////////////////////////////////////
+func (r *Resource) Wrap(m Middleware) {
+	r.wraps = append(r.wraps, m)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Add an after filter to the call. These filters run first, right after the  //
+// handler, in the order that they are added.                                 //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) After(f AfterFilter) *Call {
+	c.after = append(c.after, f)
+	return c
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Add a middleware to the call. It is the innermost, right around the        //
+// handler, and wrapped by the middleware of the resource and the API.        //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) Wrap(m Middleware) *Call {
+	c.wraps = append(c.wraps, m)
+	return c
+}
+
+// wrappedHandler returns the handler of the call wrapped by the middleware of
+// the call, the resource and the API, in that order from the inside out.
+func (c *Call) wrappedHandler() Handler {
+	h := c.handler
+	for _, wraps := range [][]Middleware{c.wraps, c.resource.wraps, c.resource.api.wraps} {
+		for i := len(wraps) - 1; i >= 0; i-- {
+			h = wraps[i](h)
+		}
+	}
+	return h
+}
+
+// runAfter runs the after filters of the call, the resource and the API, and
+// returns the error that the last of them left. While there is an error, the
+// status of the response is the one the error will be sent with.
+func (c *Call) runAfter(r *http.Request, d CallData, resp *Response, err error) error {
+	for _, after := range [][]AfterFilter{c.after, c.resource.after, c.resource.api.after} {
+		for _, f := range after {
+			if err != nil {
+				resp.Status = errorStatus(err)
+			}
+			err = nilIfTypedNil(f(r, d, resp, err))
+		}
+	}
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Wrap the resource in standard net/http middleware, e.g. compression or a   //
+// rate limiter. The middleware runs after the filters of the API, before the //
+// filters of the resource, and the first one given is the outermost. The     //
+// CallData stays in the context of the request, see DataFromContext, so      //
+// middleware that passes on r or r.WithContext(...) keeps it.                //
+////////////////////////////////////////////////////////////////////////////////
+func (r *Resource) Use(mw ...func(http.Handler) http.Handler) {
+	r.use = append(r.use, mw...)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Wrap the call in standard net/http middleware. The middleware runs after   //
+// the filters of the API and the resource, and before the filters of the     //
+// call. The matched call is in the context of the request already, see       //
+// CallFromContext.                                                           //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) Use(mw ...func(http.Handler) http.Handler) *Call {
+	c.use = append(c.use, mw...)
+	return c
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Mount a plain http.Handler, e.g. a file server or pprof, under the         //
+// resource. The handler gets every request whose path starts with the path   //
+// of the resource followed by path, whatever its method, unless one is set   //
+// with Method. The full path is passed on, use http.StripPrefix to remove    //
+// it:                                                                        //
+//                                                                            //
+//   res := sleepy.NewResource("/static")                                     //
+//   res.Mount("/", http.StripPrefix("/api/static/",                          //
+//       http.FileServer(http.Dir("public"))))                                //
+//                                                                            //
+// The returned call can have filters and net/http middleware like any other  //
+// call, but isn't part of the documentation, and has no models, after        //
+// filters or sleepy Middleware since the handler writes its own response.    //
+////////////////////////////////////////////////////////////////////////////////
+func (r *Resource) Mount(path string, h http.Handler) *Call {
+	c := r.Route(path)
+	c.mount = h
+	return c
+}
+
+// chain wraps h in the middleware, the first one being the outermost.
+func chain(h http.Handler, mw []func(http.Handler) http.Handler) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
@@ -0,0 +1,105 @@
+package sleepy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAfterFilterStatus(t *testing.T) {
+	// The handler returns the error named by the query, and the filters of
+	// the call and the resource record the status they saw
+	errs := map[string]error{
+		"http":       ErrNotFound("/api/items"),
+		"validation": ErrValidation("invalid", nil, ERR_INVALID_FIELD),
+		"hidden":     errors.New("database is down"),
+	}
+	var seen []int
+	record := func(r *http.Request, d CallData, resp *Response, err error) error {
+		seen = append(seen, resp.Status)
+		return err
+	}
+	res := NewResource("/items")
+	res.After(record)
+	res.Route("").Method("POST").ReturnsStatus(http.StatusCreated, map[string]string{}).After(record).
+		To(func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+			seen = nil
+			if err := errs[r.URL.Query().Get("err")]; err != nil {
+				return nil, err
+			}
+			return map[string]string{"id": "1"}, nil
+		})
+
+	saw := func(want int) responseCheck {
+		return func(t *testing.T, w *httptest.ResponseRecorder) {
+			if len(seen) != 2 || seen[0] != want || seen[1] != want {
+				t.Errorf("after filters saw %v, want %d", seen, want)
+			}
+		}
+	}
+	runCases(t, newTestAPI(t, res), []httpCase{
+		{title: "success", method: "POST", url: "/api/items", status: http.StatusCreated, check: saw(http.StatusCreated)},
+		{title: "http error", method: "POST", url: "/api/items?err=http", status: http.StatusNotFound, check: saw(http.StatusNotFound)},
+		{title: "validation", method: "POST", url: "/api/items?err=validation", status: http.StatusUnprocessableEntity, check: saw(http.StatusUnprocessableEntity)},
+		{title: "hidden error", method: "POST", url: "/api/items?err=hidden", status: http.StatusInternalServerError, check: saw(http.StatusInternalServerError)},
+	})
+}
+
+func TestAfterFilterReplacesError(t *testing.T) {
+	var seen int
+	res := NewResource("/items")
+	res.After(func(r *http.Request, d CallData, resp *Response, err error) error {
+		seen = resp.Status
+		return err
+	})
+	res.Route("").Method("GET").Returns(map[string]string{}).
+		After(func(r *http.Request, d CallData, resp *Response, err error) error {
+			return ErrNotFound("/api/items")
+		}).
+		To(func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+			return nil, errors.New("not there")
+		})
+	if w := do(newTestAPI(t, res), "GET", "/api/items", ""); w.Code != http.StatusNotFound || seen != http.StatusNotFound {
+		t.Errorf("got status %d, the resource filter saw %d, want 404", w.Code, seen)
+	}
+
+	// A filter that recovers sets the response to send
+	res = NewResource("/items")
+	res.Route("").Method("GET").Returns(map[string]string{}).
+		After(func(r *http.Request, d CallData, resp *Response, err error) error {
+			resp.Status, resp.Body = http.StatusOK, map[string]string{"cached": "true"}
+			return nil
+		}).
+		To(func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+			return nil, errors.New("not there")
+		})
+	if w := do(newTestAPI(t, res), "GET", "/api/items", ""); w.Code != http.StatusOK || decodeJSON(t, w)["cached"] != "true" {
+		t.Errorf("got status %d, want the recovered response: %s", w.Code, w.Body)
+	}
+}
+
+func TestAfterFilterHeaders(t *testing.T) {
+	// The filter sets a header on every response, and replaces the error of
+	// the handler when asked to
+	res := NewResource("/items")
+	res.Route("").Method("GET").Returns(map[string]string{}).
+		After(func(r *http.Request, d CallData, resp *Response, err error) error {
+			resp.Headers.Set("Retry-After", "120")
+			if r.URL.Query().Get("fail") == "filter" {
+				return ErrTimeout("GET /items")
+			}
+			return err
+		}).
+		To(func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+			if r.URL.Query().Get("fail") == "handler" {
+				return nil, ErrNotFound("/api/items")
+			}
+			return map[string]string{"id": "1"}, nil
+		})
+	runCases(t, newTestAPI(t, res), []httpCase{
+		{title: "success", url: "/api/items", status: http.StatusOK, check: hasHeader("Retry-After", "120")},
+		{title: "handler error", url: "/api/items?fail=handler", status: http.StatusNotFound, check: hasHeader("Retry-After", "120")},
+		{title: "filter error", url: "/api/items?fail=filter", status: http.StatusServiceUnavailable, check: hasHeader("Retry-After", "120")},
+	})
+}
@@ -0,0 +1,289 @@
+package sleepy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// A MessagePack codec that needs no dependencies. Values are converted to    //
+// the generic tree of encoding/json first, and the tree is then written as   //
+// MessagePack, so models behave exactly as they do with JSON: json tags,     //
+// omitempty and custom MarshalJSON methods are all respected. Decoding goes  //
+// the other way around. Byte slices travel as base64 strings, like in JSON,  //
+// and extension types are not supported.                                     //
+////////////////////////////////////////////////////////////////////////////////
+type msgpackCodec struct{}
+
+func (msgpackCodec) MediaType() string { return "application/msgpack" }
+
+func (msgpackCodec) Encode(w io.Writer, v interface{}) error {
+	jb, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(jb))
+	dec.UseNumber()
+	var tree interface{}
+	if err := dec.Decode(&tree); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	if err := writeMsgpack(bw, tree); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func (msgpackCodec) Decode(r io.Reader, v interface{}) error {
+	tree, err := readMsgpack(bufio.NewReader(r), 0)
+	if err != nil {
+		return err
+	}
+	jb, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jb, v)
+}
+
+func writeMsgpack(w *bufio.Writer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		return w.WriteByte(0xc0)
+	case bool:
+		if v {
+			return w.WriteByte(0xc3)
+		}
+		return w.WriteByte(0xc2)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return writeMsgpackInt(w, i)
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			w.WriteByte(0xcf)
+			return binary.Write(w, binary.BigEndian, u)
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		w.WriteByte(0xcb)
+		return binary.Write(w, binary.BigEndian, math.Float64bits(f))
+	case string:
+		writeMsgpackHeader(w, len(v), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		_, err := w.WriteString(v)
+		return err
+	case []interface{}:
+		writeMsgpackHeader(w, len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, e := range v {
+			if err := writeMsgpack(w, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]interface{}:
+		writeMsgpackHeader(w, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			writeMsgpack(w, k)
+			if err := writeMsgpack(w, v[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("msgpack: cannot encode %T", v)
+}
+
+func writeMsgpackInt(w *bufio.Writer, i int64) error {
+	switch {
+	case i >= 0 && i <= 0x7f, i < 0 && i >= -32:
+		return w.WriteByte(byte(i))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		w.WriteByte(0xd0)
+		return w.WriteByte(byte(i))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		w.WriteByte(0xd1)
+		return binary.Write(w, binary.BigEndian, int16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		w.WriteByte(0xd2)
+		return binary.Write(w, binary.BigEndian, int32(i))
+	}
+	w.WriteByte(0xd3)
+	return binary.Write(w, binary.BigEndian, i)
+}
+
+// writeMsgpackHeader writes the type and length of a string, array or map,
+// using the fix format below fixMax, and the 8, 16 or 32 bit formats above.
+// The 8 bit format is skipped when it's 0, as it is for arrays and maps.
+func writeMsgpackHeader(w *bufio.Writer, n int, fix byte, fixMax int, b8, b16, b32 byte) {
+	switch {
+	case n < fixMax:
+		w.WriteByte(fix | byte(n))
+	case b8 != 0 && n <= math.MaxUint8:
+		w.WriteByte(b8)
+		w.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		w.WriteByte(b16)
+		binary.Write(w, binary.BigEndian, uint16(n))
+	default:
+		w.WriteByte(b32)
+		binary.Write(w, binary.BigEndian, uint32(n))
+	}
+}
+
+var errMsgpackExt = errors.New("msgpack: extension types are not supported")
+
+// The deepest nesting of arrays and maps that is read, like encoding/json.
+const msgpackMaxDepth = 10000
+
+func readMsgpack(r *bufio.Reader, depth int) (interface{}, error) {
+	if depth > msgpackMaxDepth {
+		return nil, errors.New("msgpack: exceeded max depth")
+	}
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xe0 == 0xa0:
+		return readMsgpackString(r, int(b&0x1f))
+	case b&0xf0 == 0x90:
+		return readMsgpackArray(r, int(b&0x0f), depth)
+	case b&0xf0 == 0x80:
+		return readMsgpackMap(r, int(b&0x0f), depth)
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		var u uint64
+		err := readMsgpackUint(r, 1<<(b-0xcc), &u)
+		return u, err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		var u uint64
+		size := 1 << (b - 0xd0)
+		err := readMsgpackUint(r, size, &u)
+		// Sign extend the value from its size to 64 bits.
+		shift := uint(64 - 8*size)
+		return int64(u<<shift) >> shift, err
+	case 0xca:
+		var f float32
+		err := binary.Read(r, binary.BigEndian, &f)
+		return float64(f), err
+	case 0xcb:
+		var f float64
+		err := binary.Read(r, binary.BigEndian, &f)
+		return f, err
+	case 0xd9, 0xda, 0xdb:
+		n, err := readMsgpackLength(r, 1<<(b-0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackString(r, n)
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readMsgpackLength(r, 1<<(b-0xc4))
+		if err != nil {
+			return nil, err
+		}
+		bin, err := readMsgpackString(r, n)
+		return base64.StdEncoding.EncodeToString([]byte(bin)), err
+	case 0xdc, 0xdd:
+		n, err := readMsgpackLength(r, 2<<(b-0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackArray(r, n, depth)
+	case 0xde, 0xdf:
+		n, err := readMsgpackLength(r, 2<<(b-0xde))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackMap(r, n, depth)
+	case 0xc7, 0xc8, 0xc9, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return nil, errMsgpackExt
+	}
+	return nil, fmt.Errorf("msgpack: invalid format byte 0x%x", b)
+}
+
+func readMsgpackUint(r *bufio.Reader, size int, u *uint64) error {
+	*u = 0
+	for i := 0; i < size; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		*u = *u<<8 | uint64(b)
+	}
+	return nil
+}
+
+func readMsgpackLength(r *bufio.Reader, size int) (int, error) {
+	var u uint64
+	err := readMsgpackUint(r, size, &u)
+	return int(u), err
+}
+
+// The lengths in the input are not trusted for allocations, the buffers only
+// grow as the data arrives.
+func readMsgpackString(r *bufio.Reader, n int) (string, error) {
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(n)); err == io.EOF {
+		return "", io.ErrUnexpectedEOF
+	} else if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func readMsgpackArray(r *bufio.Reader, n int, depth int) ([]interface{}, error) {
+	arr := []interface{}{}
+	for i := 0; i < n; i++ {
+		v, err := readMsgpack(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+	}
+	return arr, nil
+}
+
+func readMsgpackMap(r *bufio.Reader, n int, depth int) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	for i := 0; i < n; i++ {
+		k, err := readMsgpack(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := readMsgpack(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		// JSON objects only have string keys.
+		m[fmt.Sprint(k)] = v
+	}
+	return m, nil
+}
@@ -0,0 +1,131 @@
+package sleepy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type msgpackModel struct {
+	Name    string            `json:"name"`
+	Count   int64             `json:"count"`
+	Small   int8              `json:"small"`
+	Big     uint64            `json:"big"`
+	Ratio   float64           `json:"ratio"`
+	On      bool              `json:"on"`
+	Data    []byte            `json:"data"`
+	Tags    []string          `json:"tags"`
+	Labels  map[string]string `json:"labels"`
+	Next    *msgpackModel     `json:"next"`
+	Skipped string            `json:"-"`
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	in := msgpackModel{
+		Name:   strings.Repeat("long name ", 10),
+		Count:  -1 << 40,
+		Small:  -5,
+		Big:    1<<64 - 1,
+		Ratio:  0.25,
+		On:     true,
+		Data:   []byte{0, 1, 2, 255},
+		Tags:   []string{"a", "b"},
+		Labels: map[string]string{"k": "v"},
+		Next:   &msgpackModel{Name: "inner", Count: 300},
+	}
+	var buf bytes.Buffer
+	if err := MessagePackCodec.Encode(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	var out msgpackModel
+	if err := MessagePackCodec.Decode(bytes.NewReader(buf.Bytes()), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
+
+func TestMsgpackEncoding(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  []byte
+	}{
+		{nil, []byte{0xc0}},
+		{true, []byte{0xc3}},
+		{5, []byte{0x05}},
+		{-1, []byte{0xff}},
+		{-100, []byte{0xd0, 0x9c}},
+		{200, []byte{0xd1, 0x00, 0xc8}},
+		{-200, []byte{0xd1, 0xff, 0x38}},
+		{"hi", []byte{0xa2, 'h', 'i'}},
+		{[]int{1}, []byte{0x91, 0x01}},
+		{map[string]int{"a": 1}, []byte{0x81, 0xa1, 'a', 0x01}},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := MessagePackCodec.Encode(&buf, test.value); err != nil {
+			t.Errorf("%v: %v", test.value, err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), test.want) {
+			t.Errorf("%v: got % x, want % x", test.value, buf.Bytes(), test.want)
+		}
+	}
+}
+
+func TestMsgpackInvalid(t *testing.T) {
+	tests := []struct {
+		title string
+		input []byte
+	}{
+		{"empty", nil},
+		{"truncated string", []byte{0xa5, 'a'}},
+		{"truncated map", []byte{0x82, 0xa1, 'a', 0x01}},
+		{"long string that isn't there", []byte{0xdb, 0xff, 0xff, 0xff, 0xff}},
+		{"extension", []byte{0xd4, 0x01, 0x00}},
+		{"never used", []byte{0xc1}},
+		{"too deep", bytes.Repeat([]byte{0x91}, msgpackMaxDepth+2)},
+	}
+	for _, test := range tests {
+		var v interface{}
+		if err := MessagePackCodec.Decode(bytes.NewReader(test.input), &v); err == nil {
+			t.Errorf("%s: decoded %v, want an error", test.title, v)
+		}
+	}
+}
+
+func TestMsgpackRequest(t *testing.T) {
+	type item struct {
+		Name  string `json:"name" sleepy:"required"`
+		Count int    `json:"count" sleepy:"required"`
+	}
+	res := NewResource("/items")
+	res.Route("").Method("POST").Reads(item{}).Returns(item{}).To(echo)
+
+	encode := func(v interface{}) string {
+		var buf bytes.Buffer
+		if err := MessagePackCodec.Encode(&buf, v); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	decodes := func(t *testing.T, w *httptest.ResponseRecorder) {
+		var out item
+		if err := MessagePackCodec.Decode(w.Body, &out); err != nil || w.Header().Get("Content-Type") != "application/msgpack" {
+			t.Errorf("got an invalid response %v: %v", w.Header(), err)
+		}
+	}
+	send := func(title, body string, status int, check responseCheck) httpCase {
+		return httpCase{title: title, method: "POST", url: "/api/items", body: body, headers: []string{"Content-Type", "application/msgpack", "Accept", "application/msgpack"}, status: status, check: check}
+	}
+	runCases(t, newTestAPI(t, res), []httpCase{
+		send("valid", encode(map[string]interface{}{"name": "a", "count": 2}), http.StatusOK, decodes),
+		send("zero value is present", encode(map[string]interface{}{"name": "", "count": 0}), http.StatusOK, decodes),
+		send("missing", encode(map[string]interface{}{"name": "a"}), http.StatusUnprocessableEntity, hasFieldErrors("count:required")),
+		send("malformed", "\xc1", http.StatusUnprocessableEntity, nil),
+	})
+}
@@ -5,11 +5,12 @@
 package mux
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"path"
-
-	"github.com/gorilla/context"
+	"sort"
+	"strings"
 )
 
 // NewRouter returns a new router instance.
@@ -37,7 +38,10 @@ func NewRouter() *Router {
 // This will send all incoming requests to the router.
 type Router struct {
 	// Configurable Handler to be used when no route matches.
-	NotFoundHandler sleepyHandler
+	NotFoundHandler http.Handler
+	// Configurable Handler to be used when a route matches everything but the
+	// method of the request. The Allow header is set before it is called.
+	MethodNotAllowedHandler http.Handler
 	// Parent route, if this is a subrouter.
 	parent parentRoute
 	// Routes to be matched, in order.
@@ -46,7 +50,8 @@ type Router struct {
 	namedRoutes map[string]*Route
 	// See Router.StrictSlash(). This defines the flag for new routes.
 	strictSlash bool
-	// If true, do not clear the request context after handling the request
+	// Deprecated: the route variables are stored in the context of the request,
+	// which ends with the request, so there is nothing to clear anymore.
 	KeepContext bool
 }
 
@@ -63,8 +68,8 @@ func (r *Router) Match(req *http.Request, match *RouteMatch) bool {
 // ServeHTTP dispatches the handler registered in the matched route.
 //
 // When there is a match, the route variables can be retrieved calling
-// mux.Vars(request).
-func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request, d map[string]interface{}) {
+// mux.Vars(request) on the request that is passed to the handler.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// Clean path to canonical form and redirect.
 	if p := cleanPath(req.URL.Path); p != req.URL.Path {
 
@@ -80,24 +85,48 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request, d map[strin
 		return
 	}
 	var match RouteMatch
-	var handler sleepyHandler
+	var handler http.Handler
 	if r.Match(req, &match) {
 		handler = match.Handler
-		setVars(req, match.Vars)
-		setCurrentRoute(req, match.Route)
+		req = setVars(req, match.Vars)
+		req = setCurrentRoute(req, match.Route)
+	}
+	if handler == nil {
+		if methods := r.AllowedMethods(req); len(methods) > 0 {
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			handler = r.MethodNotAllowedHandler
+			if handler == nil {
+				handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+				})
+			}
+		}
 	}
 	if handler == nil {
 		handler = r.NotFoundHandler
 		if handler == nil {
-			handler = sleepyHandlerFunc(func(w http.ResponseWriter, r *http.Request, d map[string]interface{}) {
-				http.NotFoundHandler().ServeHTTP(w, r)
-			})
+			handler = http.NotFoundHandler()
 		}
 	}
-	if !r.KeepContext {
-		defer context.Clear(req)
+	handler.ServeHTTP(w, req)
+}
+
+// AllowedMethods returns the methods accepted by the routes that match the
+// request in everything but its method, sorted and without duplicates. It is
+// empty if no route matches the rest of the request.
+func (r *Router) AllowedMethods(req *http.Request) []string {
+	seen := make(map[string]bool)
+	var methods []string
+	for _, route := range r.routes {
+		for _, m := range route.allowedMethods(req) {
+			if !seen[m] {
+				seen[m] = true
+				methods = append(methods, m)
+			}
+		}
 	}
-	handler.ServeHTTP(w, req, d)
+	sort.Strings(methods)
+	return methods
 }
 
 // Get returns a route registered with the given name.
@@ -114,16 +143,16 @@ func (r *Router) GetRoute(name string) *Route {
 // StrictSlash defines the trailing slash behavior for new routes. The initial
 // value is false.
 //
-// When true, if the route path is "/path/", accessing "/path" will redirect
-// to the former and vice versa. In other words, your application will always
-// see the path as specified in the route.
+// When true, if the route path is "/path/", accessing "/path" will match the
+// route too, and vice versa. Unlike in gorilla/mux, the client is not
+// redirected, so handlers may see either path.
 //
 // When false, if the route path is "/path", accessing "/path/" will not match
 // this route and vice versa.
 //
 // Special case: when a route sets a path prefix using the PathPrefix() method,
-// strict slash is ignored for that route because the redirect behavior can't
-// be determined from a prefix alone. However, any subrouters created from that
+// strict slash is ignored for that route because the trailing slash can't be
+// determined from a prefix alone. However, any subrouters created from that
 // route inherit the original StrictSlash setting.
 func (r *Router) StrictSlash(value bool) *Router {
 	r.strictSlash = value
@@ -174,14 +203,14 @@ func (r *Router) NewRoute() *Route {
 
 // Handle registers a new route with a matcher for the URL path.
 // See Route.Path() and Route.Handler().
-func (r *Router) Handle(path string, handler sleepyHandler) *Route {
+func (r *Router) Handle(path string, handler http.Handler) *Route {
 	return r.NewRoute().Path(path).Handler(handler)
 }
 
 // HandleFunc registers a new route with a matcher for the URL path.
 // See Route.Path() and Route.HandlerFunc().
 func (r *Router) HandleFunc(path string, f func(http.ResponseWriter,
-	*http.Request, map[string]interface{})) *Route {
+	*http.Request)) *Route {
 	return r.NewRoute().Path(path).HandlerFunc(f)
 }
 
@@ -246,7 +275,7 @@ func (r *Router) BuildVarsFunc(f BuildVarsFunc) *Route {
 // RouteMatch stores information about a matched route.
 type RouteMatch struct {
 	Route   *Route
-	Handler sleepyHandler
+	Handler http.Handler
 	Vars    map[string]string
 }
 
@@ -259,7 +288,13 @@ const (
 
 // Vars returns the route variables for the current request, if any.
 func Vars(r *http.Request) map[string]string {
-	if rv := context.Get(r, varsKey); rv != nil {
+	return VarsFromContext(r.Context())
+}
+
+// VarsFromContext returns the route variables stored in the context of a
+// request, if any.
+func VarsFromContext(ctx context.Context) map[string]string {
+	if rv := ctx.Value(varsKey); rv != nil {
 		return rv.(map[string]string)
 	}
 	return nil
@@ -267,18 +302,18 @@ func Vars(r *http.Request) map[string]string {
 
 // CurrentRoute returns the matched route for the current request, if any.
 func CurrentRoute(r *http.Request) *Route {
-	if rv := context.Get(r, routeKey); rv != nil {
+	if rv := r.Context().Value(routeKey); rv != nil {
 		return rv.(*Route)
 	}
 	return nil
 }
 
-func setVars(r *http.Request, val interface{}) {
-	context.Set(r, varsKey, val)
+func setVars(r *http.Request, val map[string]string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), varsKey, val))
 }
 
-func setCurrentRoute(r *http.Request, val interface{}) {
-	context.Set(r, routeKey, val)
+func setCurrentRoute(r *http.Request, val *Route) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), routeKey, val))
 }
 
 // ----------------------------------------------------------------------------
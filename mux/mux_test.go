@@ -7,9 +7,8 @@ package mux
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
-
-	"github.com/gorilla/context"
 )
 
 type routeTest struct {
@@ -478,6 +477,65 @@ func TestMethods(t *testing.T) {
 	}
 }
 
+func TestMethodNotAllowed(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	r := NewRouter()
+	r.HandleFunc("/items", handler).Methods("GET", "POST")
+	r.HandleFunc("/items", handler).Methods("GET", "DELETE")
+	r.HandleFunc("/items/{id:[0-9]+}", handler).Methods("PUT")
+	r.HandleFunc("/any", handler)
+	s := r.PathPrefix("/sub").Subrouter()
+	s.HandleFunc("/items", handler).Methods("PATCH")
+	r.HandleFunc("/hosted", handler).Host("example.com").Methods("GET")
+
+	tests := []struct {
+		title  string
+		method string
+		url    string
+		status int
+		allow  string
+	}{
+		{"method matches", "GET", "http://localhost/items", http.StatusOK, ""},
+		{"method mismatch", "PUT", "http://localhost/items", http.StatusMethodNotAllowed, "DELETE, GET, POST"},
+		{"path mismatch", "GET", "http://localhost/nothing", http.StatusNotFound, ""},
+		{"pattern mismatch", "GET", "http://localhost/items/abc", http.StatusNotFound, ""},
+		{"method mismatch on a pattern", "GET", "http://localhost/items/1", http.StatusMethodNotAllowed, "PUT"},
+		{"route without methods", "PUT", "http://localhost/any", http.StatusOK, ""},
+		{"method mismatch in a subrouter", "GET", "http://localhost/sub/items", http.StatusMethodNotAllowed, "PATCH"},
+		{"path mismatch in a subrouter", "PATCH", "http://localhost/sub/nothing", http.StatusNotFound, ""},
+		{"host mismatch", "POST", "http://other.com/hosted", http.StatusNotFound, ""},
+		{"method mismatch with a host", "POST", "http://example.com/hosted", http.StatusMethodNotAllowed, "GET"},
+		{"options without a handler", "OPTIONS", "http://localhost/items", http.StatusMethodNotAllowed, "DELETE, GET, POST"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, newRequest(test.method, test.url))
+		if w.Code != test.status || w.Header().Get("Allow") != test.allow {
+			t.Errorf("(%v) %s %s: got %d with Allow %q, want %d with Allow %q", test.title, test.method, test.url, w.Code, w.Header().Get("Allow"), test.status, test.allow)
+		}
+	}
+
+	// The MethodNotAllowedHandler can answer OPTIONS requests with the Allow
+	// header the router sets
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusTeapot)
+	})
+	for _, test := range []struct {
+		method string
+		status int
+	}{{"OPTIONS", http.StatusNoContent}, {"PUT", http.StatusTeapot}} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, newRequest(test.method, "http://localhost/items"))
+		if w.Code != test.status || w.Header().Get("Allow") != "DELETE, GET, POST" {
+			t.Errorf("%s with a MethodNotAllowedHandler: got %d with Allow %q", test.method, w.Code, w.Header().Get("Allow"))
+		}
+	}
+}
+
 func TestQueries(t *testing.T) {
 	tests := []routeTest{
 		{
@@ -735,14 +793,14 @@ func TestStrictSlash(t *testing.T) {
 
 	tests := []routeTest{
 		{
-			title:          "Redirect path without slash",
+			title:          "Match path without slash",
 			route:          r.NewRoute().Path("/111/"),
 			request:        newRequest("GET", "http://localhost/111"),
 			vars:           map[string]string{},
 			host:           "",
 			path:           "/111/",
 			shouldMatch:    true,
-			shouldRedirect: true,
+			shouldRedirect: false,
 		},
 		{
 			title:          "Do not redirect path with slash",
@@ -755,14 +813,14 @@ func TestStrictSlash(t *testing.T) {
 			shouldRedirect: false,
 		},
 		{
-			title:          "Redirect path with slash",
+			title:          "Match path with slash",
 			route:          r.NewRoute().Path("/111"),
 			request:        newRequest("GET", "http://localhost/111/"),
 			vars:           map[string]string{},
 			host:           "",
 			path:           "/111",
 			shouldMatch:    true,
-			shouldRedirect: true,
+			shouldRedirect: false,
 		},
 		{
 			title:          "Do not redirect path without slash",
@@ -782,7 +840,7 @@ func TestStrictSlash(t *testing.T) {
 			host:           "",
 			path:           "/static/images/",
 			shouldMatch:    true,
-			shouldRedirect: true,
+			shouldRedirect: false,
 		},
 		{
 			title:          "Ignore StrictSlash for path prefix",
@@ -875,34 +933,31 @@ func testRoute(t *testing.T, test routeTest) {
 	}
 }
 
-// Tests that the context is cleared or not cleared properly depending on
-// the configuration of the router
-func TestKeepContext(t *testing.T) {
-	func1 := func(w http.ResponseWriter, r *http.Request) {}
+// Tests that the route variables are stored in the context of the request
+// that is passed to the handler, and not in the original request.
+func TestVarsContext(t *testing.T) {
+	var vars map[string]string
+	var route *Route
+	func1 := func(w http.ResponseWriter, r *http.Request) {
+		vars = Vars(r)
+		route = CurrentRoute(r)
+	}
 
 	r := NewRouter()
-	r.HandleFunc("/", func1).Name("func1")
+	r.HandleFunc("/{id}", func1).Name("func1")
 
-	req, _ := http.NewRequest("GET", "http://localhost/", nil)
-	context.Set(req, "t", 1)
+	req, _ := http.NewRequest("GET", "http://localhost/42", nil)
+	r.ServeHTTP(httptest.NewRecorder(), req)
 
-	res := new(http.ResponseWriter)
-	r.ServeHTTP(*res, req)
-
-	if _, ok := context.GetOk(req, "t"); ok {
-		t.Error("Context should have been cleared at end of request")
+	if vars["id"] != "42" {
+		t.Errorf("Expected the handler to see id 42, got %v", vars)
 	}
-
-	r.KeepContext = true
-
-	req, _ = http.NewRequest("GET", "http://localhost/", nil)
-	context.Set(req, "t", 1)
-
-	r.ServeHTTP(*res, req)
-	if _, ok := context.GetOk(req, "t"); !ok {
-		t.Error("Context should NOT have been cleared at end of request")
+	if route == nil || route.GetName() != "func1" {
+		t.Error("Expected the handler to see the matched route")
+	}
+	if Vars(req) != nil {
+		t.Error("The original request should not carry any variables")
 	}
-
 }
 
 type TestA301ResponseWriter struct {
@@ -620,10 +620,8 @@ func TestRedirectSlash(t *testing.T) {
 	if vars["arg2"] != "123" {
 		t.Errorf("Expected 123.")
 	}
-	rsp := NewRecorder()
-	routeMatch.Handler.ServeHTTP(rsp, request)
-	if rsp.HeaderMap.Get("Location") != "http://localhost/foo/123/" {
-		t.Errorf("Expected redirect header.")
+	if routeMatch.Handler != nil {
+		t.Errorf("Expected no redirect.")
 	}
 
 	route = new(Route)
@@ -639,10 +637,8 @@ func TestRedirectSlash(t *testing.T) {
 	if vars["arg2"] != "123" {
 		t.Errorf("Expected 123.")
 	}
-	rsp = NewRecorder()
-	routeMatch.Handler.ServeHTTP(rsp, request)
-	if rsp.HeaderMap.Get("Location") != "http://localhost/foo/123" {
-		t.Errorf("Expected redirect header.")
+	if routeMatch.Handler != nil {
+		t.Errorf("Expected no redirect.")
 	}
 }
 
@@ -12,22 +12,12 @@ import (
 	"strings"
 )
 
-type sleepyHandler interface {
-	ServeHTTP(http.ResponseWriter, *http.Request, map[string]interface{})
-}
-
-type sleepyHandlerFunc func(http.ResponseWriter, *http.Request, map[string]interface{})
-
-func (shf sleepyHandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request, d map[string]interface{}) {
-	shf(w, r, d)
-}
-
 // Route stores information to match a request and build URLs.
 type Route struct {
 	// Parent where the route was registered (a Router).
 	parent parentRoute
 	// Request handler for the route.
-	handler sleepyHandler
+	handler http.Handler
 	// List of matchers.
 	matchers []matcher
 	// Manager for the variables from host and path.
@@ -73,6 +63,33 @@ func (r *Route) Match(req *http.Request, match *RouteMatch) bool {
 	return true
 }
 
+// allowedMethods returns the methods the route would accept for the request,
+// if everything but the method matches. It returns nil if another matcher
+// fails, or if the route does not restrict the method at all.
+func (r *Route) allowedMethods(req *http.Request) []string {
+	if r.buildOnly || r.err != nil {
+		return nil
+	}
+	var methods []string
+	for _, m := range r.matchers {
+		switch m := m.(type) {
+		case methodMatcher:
+			methods = append(methods, m...)
+		case *Router:
+			sub := m.AllowedMethods(req)
+			if len(sub) == 0 {
+				return nil
+			}
+			methods = append(methods, sub...)
+		default:
+			if !m.Match(req, &RouteMatch{}) {
+				return nil
+			}
+		}
+	}
+	return methods
+}
+
 // ----------------------------------------------------------------------------
 // Route attributes
 // ----------------------------------------------------------------------------
@@ -91,7 +108,7 @@ func (r *Route) BuildOnly() *Route {
 // Handler --------------------------------------------------------------------
 
 // Handler sets a handler for the route.
-func (r *Route) Handler(handler sleepyHandler) *Route {
+func (r *Route) Handler(handler http.Handler) *Route {
 	if r.err == nil {
 		r.handler = handler
 	}
@@ -99,12 +116,12 @@ func (r *Route) Handler(handler sleepyHandler) *Route {
 }
 
 // HandlerFunc sets a handler function for the route.
-func (r *Route) HandlerFunc(f func(http.ResponseWriter, *http.Request, map[string]interface{})) *Route {
-	return r.Handler(sleepyHandlerFunc(f))
+func (r *Route) HandlerFunc(f func(http.ResponseWriter, *http.Request)) *Route {
+	return r.Handler(http.HandlerFunc(f))
 }
 
 // GetHandler returns the handler for the route, if any.
-func (r *Route) GetHandler() sleepyHandler {
+func (r *Route) GetHandler() http.Handler {
 	return r.handler
 }
 
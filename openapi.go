@@ -0,0 +1,652 @@
+package sleepy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// Functions that turn the resources and calls registered with an API into an //
+// OpenAPI 3 document. The document is built entirely from the callDataModel  //
+// of every call, so it can never drift from the code that actually serves    //
+// the API.                                                                   //
+//                                                                            //
+// Models given to Reads() and Returns() are converted into JSON schemas by   //
+// reflection and stored under components/schemas. The sleepy field tags are  //
+// mapped onto the schema: required fields are listed as required, readonly   //
+// and writeonly fields are marked readOnly and writeOnly, and hidden fields  //
+// are left out of the schema entirely.                                       //
+////////////////////////////////////////////////////////////////////////////////
+const openAPIVersion = "3.0.3"
+
+type openAPIDoc struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*jsonSchema       `json:"schemas"`
+	SecuritySchemes map[string]SecuritySchemeDoc `json:"securitySchemes,omitempty"`
+}
+
+type openAPIOperation struct {
+	OperationID string                      `json:"operationId,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []openAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+	// Nil for calls without schemes, and empty for calls made public.
+	Security *[]map[string][]string `json:"security,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string      `json:"name"`
+	In          string      `json:"in"`
+	Description string      `json:"description,omitempty"`
+	Required    bool        `json:"required"`
+	Schema      *jsonSchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                         `json:"required"`
+	Content  map[string]*openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *jsonSchema `json:"schema"`
+}
+
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	AllOf                []*jsonSchema          `json:"allOf,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Default              interface{}            `json:"default,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+	MinProperties        *int                   `json:"minProperties,omitempty"`
+	MaxProperties        *int                   `json:"maxProperties,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	ReadOnly             bool                   `json:"readOnly,omitempty"`
+	WriteOnly            bool                   `json:"writeOnly,omitempty"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Set the title, version and description that are written to the info        //
+// section of the generated OpenAPI document.                                 //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) Info(title, version, description string) {
+	api.title = title
+	api.version = version
+	api.description = description
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Build an OpenAPI 3 document describing every resource and call that has    //
+// been registered with the API, and return it as indented JSON.              //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) OpenAPI() ([]byte, error) {
+	return json.MarshalIndent(api.openAPIDoc(), "", "  ")
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Same as OpenAPI(), but the document is returned as YAML.                   //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) OpenAPIYAML() ([]byte, error) {
+	jb, err := json.Marshal(api.openAPIDoc())
+	if err != nil {
+		return nil, err
+	}
+	// Decode the JSON document into generic values so that the key order
+	// and omitempty behaviour of the JSON document is kept.
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(jb))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writeYAML(&buf, doc, 0)
+	return buf.Bytes(), nil
+}
+
+func (api *API) openAPIDoc() *openAPIDoc {
+	doc := &openAPIDoc{
+		OpenAPI: openAPIVersion,
+		Info: openAPIInfo{
+			Title:       api.title,
+			Description: api.description,
+			Version:     api.version,
+		},
+		Paths: make(map[string]map[string]*openAPIOperation),
+	}
+	if doc.Info.Title == "" {
+		doc.Info.Title = "API"
+	}
+	if doc.Info.Version == "" {
+		doc.Info.Version = "1.0.0"
+	}
+
+	sb := newSchemaBuilder()
+	errorContent := map[string]*openAPIMediaType{
+		"application/json": {Schema: sb.schemaFor(reflect.TypeOf(Error{}))},
+	}
+	if api.problemDetails {
+		errorContent = map[string]*openAPIMediaType{
+			"application/problem+json": {Schema: sb.schemaFor(reflect.TypeOf(Problem{}))},
+		}
+	}
+
+	for _, res := range api.resources {
+		for _, call := range res.calls {
+			if call.mount != nil {
+				continue
+			}
+			path, _ := parseTemplate(api.basePath + res.path + call.path)
+			if doc.Paths[path] == nil {
+				doc.Paths[path] = make(map[string]*openAPIOperation)
+			}
+			method := strings.ToLower(call.method)
+			if method == "" {
+				method = "get"
+			}
+			op := call.openAPIOperation(res, api.basePath+res.path+call.path, sb)
+			op.Responses["default"] = &openAPIResponse{Description: "Error", Content: errorContent}
+			if op.Security != nil && len(*op.Security) > 0 {
+				op.Responses["401"] = &openAPIResponse{Description: http.StatusText(http.StatusUnauthorized), Content: errorContent}
+			}
+			doc.Paths[path][method] = op
+		}
+	}
+	doc.Components.Schemas = sb.schemas
+	if len(api.schemes) > 0 {
+		doc.Components.SecuritySchemes = make(map[string]SecuritySchemeDoc)
+		for name, v := range api.schemes {
+			doc.Components.SecuritySchemes[name] = v.Describe()
+		}
+	}
+	return doc
+}
+
+func (c *Call) openAPIOperation(res *Resource, tpl string, sb *schemaBuilder) *openAPIOperation {
+	op := &openAPIOperation{
+		OperationID: c.operationName,
+		Responses:   make(map[string]*openAPIResponse),
+	}
+	if tag := strings.Trim(res.path, "/"); tag != "" {
+		op.Tags = []string{tag}
+	}
+
+	declared := make(map[string]bool)
+	for _, v := range c.model.pathVars {
+		op.Parameters = append(op.Parameters, v.openAPIParameter("path"))
+		declared[v.name] = true
+	}
+	// Variables of the path that weren't declared are passed on as strings.
+	_, names := parseTemplate(tpl)
+	for _, name := range names {
+		if !declared[name] {
+			op.Parameters = append(op.Parameters, newInputVar(varString, name, "", true, nil).openAPIParameter("path"))
+		}
+	}
+	for _, v := range c.model.queryVars {
+		op.Parameters = append(op.Parameters, v.openAPIParameter("query"))
+	}
+
+	if c.model.bodyIn.model != nil {
+		op.RequestBody = &openAPIRequestBody{
+			Required: true,
+			Content:  res.api.openAPIContent(sb.schemaFor(reflect.TypeOf(c.model.bodyIn.model))),
+		}
+		if c.patch {
+			op.RequestBody.Content = map[string]*openAPIMediaType{
+				mediaMergePatch: {Schema: sb.schemaFor(reflect.TypeOf(c.model.bodyIn.model))},
+				mediaJSONPatch:  {Schema: jsonPatchSchema()},
+			}
+		}
+	}
+
+	for _, out := range c.model.bodyOut {
+		resp := &openAPIResponse{Description: http.StatusText(out.status)}
+		if out.model != nil {
+			resp.Content = res.api.openAPIContent(sb.schemaFor(reflect.TypeOf(out.model)))
+		}
+		op.Responses[strconv.Itoa(out.status)] = resp
+	}
+	if len(c.model.bodyOut) == 0 {
+		op.Responses["200"] = &openAPIResponse{Description: "OK"}
+	}
+
+	// Any one of the schemes is enough, so each gets its own requirement.
+	if schemes := c.securitySchemes(); schemes != nil {
+		security := make([]map[string][]string, len(schemes))
+		for i, name := range schemes {
+			security[i] = map[string][]string{name: {}}
+		}
+		op.Security = &security
+	}
+	return op
+}
+
+// jsonPatchSchema describes the operations of a JSON Patch document.
+func jsonPatchSchema() *jsonSchema {
+	str := func() *jsonSchema { return &jsonSchema{Type: "string"} }
+	op := str()
+	for _, name := range []string{"add", "remove", "replace", "move", "copy", "test"} {
+		op.Enum = append(op.Enum, name)
+	}
+	return &jsonSchema{
+		Type: "array",
+		Items: &jsonSchema{
+			Type:       "object",
+			Required:   []string{"op", "path"},
+			Properties: map[string]*jsonSchema{"op": op, "path": str(), "from": str(), "value": {}},
+		},
+	}
+}
+
+// openAPIContent describes a body with the schema in every media type that the
+// codecs of the API can read and write.
+func (api *API) openAPIContent(schema *jsonSchema) map[string]*openAPIMediaType {
+	content := make(map[string]*openAPIMediaType)
+	for _, c := range api.codecs {
+		content[c.MediaType()] = &openAPIMediaType{Schema: schema}
+	}
+	return content
+}
+
+func (v inputVar) openAPIParameter(in string) openAPIParameter {
+	return openAPIParameter{
+		Name:        v.name,
+		In:          in,
+		Description: v.desc,
+		Required:    v.required || in == "path",
+		Schema:      v.schema(),
+	}
+}
+
+func (v inputVar) schema() *jsonSchema {
+	s := &jsonSchema{Type: v.typ}
+	switch v.typ {
+	case varTime:
+		s.Type, s.Format = "string", "date-time"
+	case varUUID:
+		s.Type, s.Format = "string", "uuid"
+	case varEnum:
+		s.Type = "string"
+		for _, e := range v.enum {
+			s.Enum = append(s.Enum, e)
+		}
+	case varInteger:
+		if v.min != nil {
+			min := float64(*v.min)
+			s.Minimum = &min
+		}
+		if v.max != nil {
+			max := float64(*v.max)
+			s.Maximum = &max
+		}
+	case varString:
+		s.MinLength, s.MaxLength = v.min, v.max
+		if v.pattern != nil {
+			s.Pattern = v.pattern.String()
+		}
+	}
+	if v.def != nil {
+		// Use the parsed value so that the default has the right JSON type.
+		if def, ferr := v.parse(*v.def); ferr == nil {
+			s.Default = def
+		}
+	}
+	return s
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// schemaBuilder converts Go types into JSON schemas. Named struct types are  //
+// added to the schemas map once and referenced with $ref everywhere they are //
+// used, which also allows recursive models to be described.                  //
+////////////////////////////////////////////////////////////////////////////////
+type schemaBuilder struct {
+	schemas map[string]*jsonSchema
+	names   map[reflect.Type]string
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{
+		schemas: make(map[string]*jsonSchema),
+		names:   make(map[reflect.Type]string),
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (sb *schemaBuilder) schemaFor(t reflect.Type) *jsonSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &jsonSchema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &jsonSchema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64:
+		return &jsonSchema{Type: "integer", Format: "int64"}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		zero := 0.0
+		return &jsonSchema{Type: "integer", Minimum: &zero}
+	case reflect.Float32:
+		return &jsonSchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &jsonSchema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &jsonSchema{Type: "string", Format: "byte"}
+		}
+		return &jsonSchema{Type: "array", Items: sb.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: sb.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return sb.structSchema(t)
+		}
+		return &jsonSchema{Ref: "#/components/schemas/" + sb.define(t)}
+	}
+	// Interfaces, and anything else that can't be described, accept any value.
+	return &jsonSchema{}
+}
+
+// define adds the schema of a named struct to the components and returns the
+// name it was stored under. Types with the same name from different packages
+// are told apart by their package, and then by a number.
+func (sb *schemaBuilder) define(t reflect.Type) string {
+	if name, ok := sb.names[t]; ok {
+		return name
+	}
+	name := componentName(t.Name())
+	if _, taken := sb.schemas[name]; taken {
+		pkg := t.PkgPath()
+		name = componentName(pkg[strings.LastIndex(pkg, "/")+1:]) + "_" + name
+	}
+	for i, base := 2, name; ; i++ {
+		if _, taken := sb.schemas[name]; !taken {
+			break
+		}
+		name = base + "_" + strconv.Itoa(i)
+	}
+	sb.names[t] = name
+	// Reserve the name before building the schema so recursive types resolve.
+	sb.schemas[name] = nil
+	sb.schemas[name] = sb.structSchema(t)
+	return name
+}
+
+var (
+	typeQualifier    = regexp.MustCompile(`[\w./-]*\.`)
+	invalidComponent = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// componentName turns the name of a type into a valid name for the components
+// of the document, which only allow letters, digits, ".", "-" and "_". The
+// type arguments of generic types lose their packages, so Page[main.User]
+// becomes Page_User.
+func componentName(name string) string {
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i] + typeQualifier.ReplaceAllString(name[i:], "")
+	}
+	return strings.Trim(invalidComponent.ReplaceAllString(name, "_"), "_")
+}
+
+func (sb *schemaBuilder) structSchema(t reflect.Type) *jsonSchema {
+	s := &jsonSchema{Type: "object", Properties: make(map[string]*jsonSchema)}
+	sb.addFields(s, t)
+	return s
+}
+
+// addFields adds the properties of a struct to s. Embedded structs without a
+// json name are flattened into s, the same way encoding/json marshals them.
+func (sb *schemaBuilder) addFields(s *jsonSchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := jsonFieldName(field)
+		if !ok || hasSleepyTag(field, sleepyHidden) {
+			continue
+		}
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if field.Anonymous && ft.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			sb.addFields(s, ft)
+			continue
+		}
+
+		prop := sb.schemaFor(field.Type)
+		if hasJSONOption(field, "string") {
+			prop = &jsonSchema{Type: "string"}
+		}
+		applyConstraints(prop, field)
+		ro := hasSleepyTag(field, sleepyReadOnly)
+		wo := hasSleepyTag(field, sleepyWriteOnly)
+		if ro || wo {
+			// Siblings of $ref are ignored, so wrap the reference in allOf.
+			if prop.Ref != "" {
+				prop = &jsonSchema{AllOf: []*jsonSchema{prop}}
+			}
+			prop.ReadOnly = ro
+			prop.WriteOnly = wo
+		}
+		s.Properties[name] = prop
+		if hasSleepyTag(field, sleepyRequired) {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// applyConstraints adds the constraint tags of a field to its schema. Tags
+// other than minLen and maxLen describe the elements of slices and maps.
+func applyConstraints(prop *jsonSchema, field reflect.StructField) {
+	for _, item := range parseSleepyTag(field.Tag.Get("sleepy")) {
+		target := prop
+		if item[0] != sleepyMinLen && item[0] != sleepyMaxLen {
+			if prop.Items != nil {
+				target = prop.Items
+			} else if prop.AdditionalProperties != nil {
+				target = prop.AdditionalProperties
+			}
+		}
+		if target.Ref != "" {
+			continue
+		}
+		num, _ := strconv.ParseFloat(item[1], 64)
+		length := int(num)
+		switch item[0] {
+		case sleepyMin:
+			if target.Type == "integer" || target.Type == "number" {
+				target.Minimum = &num
+			}
+		case sleepyMax:
+			if target.Type == "integer" || target.Type == "number" {
+				target.Maximum = &num
+			}
+		case sleepyMinLen:
+			if target.Type == "array" {
+				target.MinItems = &length
+			} else if target.Type == "object" {
+				target.MinProperties = &length
+			} else {
+				target.MinLength = &length
+			}
+		case sleepyMaxLen:
+			if target.Type == "array" {
+				target.MaxItems = &length
+			} else if target.Type == "object" {
+				target.MaxProperties = &length
+			} else {
+				target.MaxLength = &length
+			}
+		case sleepyEnum:
+			target.Enum = nil
+			for _, e := range strings.Split(item[1], "|") {
+				if target.Type == "integer" || target.Type == "number" {
+					if n, err := strconv.ParseFloat(e, 64); err == nil {
+						target.Enum = append(target.Enum, n)
+						continue
+					}
+				}
+				target.Enum = append(target.Enum, e)
+			}
+		case sleepyPattern:
+			target.Pattern = item[1]
+		case sleepyEmail:
+			target.Format = "email"
+		case sleepyURL:
+			target.Format = "uri"
+		case sleepyUUID:
+			target.Format = "uuid"
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Split a route template into the OpenAPI form of the path and the names of  //
+// its variables. Variables may carry a pattern, as in {id:[0-9]+}, which is  //
+// dropped from the returned path.                                            //
+////////////////////////////////////////////////////////////////////////////////
+func parseTemplate(tpl string) (string, []string) {
+	var path bytes.Buffer
+	var vars []string
+	level, start := 0, 0
+	for i := 0; i < len(tpl); i++ {
+		switch tpl[i] {
+		case '{':
+			if level == 0 {
+				start = i + 1
+			}
+			level++
+			continue
+		case '}':
+			level--
+			if level == 0 {
+				name := strings.SplitN(tpl[start:i], ":", 2)[0]
+				vars = append(vars, name)
+				path.WriteString("{" + name + "}")
+			}
+			continue
+		}
+		if level == 0 {
+			path.WriteByte(tpl[i])
+		}
+	}
+	return path.String(), vars
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// A minimal YAML writer for the generic values produced by encoding/json.    //
+// Strings are always written in the double quoted style, which shares its    //
+// escaping rules with JSON.                                                  //
+////////////////////////////////////////////////////////////////////////////////
+func writeYAML(buf *bytes.Buffer, v interface{}, indent int) {
+	pad := strings.Repeat("  ", indent)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			buf.WriteString(pad + yamlKey(k) + ":")
+			writeYAMLChild(buf, v[k], indent)
+		}
+	case []interface{}:
+		for _, item := range v {
+			buf.WriteString(pad + "-")
+			writeYAMLChild(buf, item, indent)
+		}
+	default:
+		buf.WriteString(pad + yamlScalar(v) + "\n")
+	}
+}
+
+func writeYAMLChild(buf *bytes.Buffer, v interface{}, indent int) {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		if len(c) == 0 {
+			buf.WriteString(" {}\n")
+			return
+		}
+	case []interface{}:
+		if len(c) == 0 {
+			buf.WriteString(" []\n")
+			return
+		}
+	default:
+		buf.WriteString(" " + yamlScalar(v) + "\n")
+		return
+	}
+	buf.WriteString("\n")
+	writeYAML(buf, v, indent+1)
+}
+
+// yamlKey writes keys such as paths and property names without quotes when
+// they can't be mistaken for another type.
+func yamlKey(k string) string {
+	if plainYAMLKey.MatchString(k) && !reservedYAMLKey.MatchString(k) {
+		return k
+	}
+	return strconv.Quote(k)
+}
+
+var (
+	plainYAMLKey    = regexp.MustCompile(`^[A-Za-z_$/][A-Za-z0-9_$/{}.-]*$`)
+	reservedYAMLKey = regexp.MustCompile(`^(?i:y|n|yes|no|on|off|true|false|null)$`)
+)
+
+func yamlScalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case string:
+		return strconv.Quote(v)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,79 @@
+package sleepy
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/tortis/sleepy/mux"
+)
+
+type Page[T any] struct {
+	Items []T
+	Next  string
+}
+
+type Pair[A, B any] struct {
+	First  A
+	Second B
+}
+
+type Route struct {
+	Path string
+}
+
+type docModels struct {
+	Users    Page[Route]
+	Pairs    Page[Pair[Route, int]]
+	Local    Route
+	External mux.Route
+}
+
+func TestComponentName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"User", "User"},
+		{"Page[main.User]", "Page_User"},
+		{"Page[github.com/acme/api/models.User]", "Page_User"},
+		{"Pair[main.User,int]", "Pair_User_int"},
+		{"Page[[]main.User]", "Page_User"},
+		{"Page[map[string]gopkg.in/yaml.v3.Node]", "Page_map_string_Node"},
+		{"Page[main.Pair[main.A,main.B]]", "Page_Pair_A_B"},
+	}
+	for _, test := range tests {
+		if got := componentName(test.name); got != test.want {
+			t.Errorf("componentName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOpenAPIComponentNames(t *testing.T) {
+	res := NewResource("/docs")
+	res.Route("").Method("GET").Returns(docModels{}).To(returns(nil, nil))
+	api := newTestAPI(t, res)
+	b, err := api.OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Components struct {
+			Schemas map[string]json.RawMessage
+		}
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	valid := regexp.MustCompile(`^[a-zA-Z0-9.\-_]+$`)
+	for name := range doc.Components.Schemas {
+		if !valid.MatchString(name) {
+			t.Errorf("invalid component name %q", name)
+		}
+	}
+	for _, name := range []string{"docModels", "Page_Route", "Page_Pair_Route_int", "Pair_Route_int", "Route", "mux_Route"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("no component %q in %v", name, doc.Components.Schemas)
+		}
+	}
+}
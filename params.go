@@ -0,0 +1,251 @@
+package sleepy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tortis/sleepy/mux"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// The types of input variables. They double as the type names that are used  //
+// when the variables are described in the OpenAPI document.                  //
+////////////////////////////////////////////////////////////////////////////////
+const (
+	varString  = "string"
+	varInteger = "integer"
+	varBoolean = "boolean"
+	varTime    = "time"
+	varEnum    = "enum"
+	varUUID    = "uuid"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+////////////////////////////////////////////////////////////////////////////////
+// The parsed values of the path and query variables declared on a call. The  //
+// values have already been converted to the type of their declaration, so an //
+// integer variable can be read with Int() without any further parsing.       //
+// Optional variables that were not sent, and have no default, are absent.    //
+////////////////////////////////////////////////////////////////////////////////
+type Params map[string]interface{}
+
+// Check if the variable was sent by the client or has a default value.
+func (p Params) Has(name string) bool {
+	_, ok := p[name]
+	return ok
+}
+
+// The value of a string, enum or uuid variable.
+func (p Params) String(name string) string {
+	s, _ := p[name].(string)
+	return s
+}
+
+// The value of an integer variable.
+func (p Params) Int(name string) int {
+	i, _ := p[name].(int)
+	return i
+}
+
+// The value of a boolean variable.
+func (p Params) Bool(name string) bool {
+	b, _ := p[name].(bool)
+	return b
+}
+
+// The value of a time variable.
+func (p Params) Time(name string) time.Time {
+	t, _ := p[name].(time.Time)
+	return t
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Get the parsed path and query variables of the call from the CallData.     //
+////////////////////////////////////////////////////////////////////////////////
+func (d CallData) Params() Params {
+	return paramsKey.Value(d)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Options that can be given to the QueryVar and PathParam builder methods to //
+// constrain the value of the variable.                                       //
+////////////////////////////////////////////////////////////////////////////////
+type VarOption func(*inputVar)
+
+////////////////////////////////////////////////////////////////////////////////
+// The value used when an optional variable is not sent by the client. The    //
+// default is written as it would be in a URL and is parsed like any other    //
+// value of the variable.                                                     //
+////////////////////////////////////////////////////////////////////////////////
+func Default(value string) VarOption {
+	return func(v *inputVar) {
+		v.def = &value
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// The smallest accepted value of an integer variable, or the shortest        //
+// accepted length of a string variable.                                      //
+////////////////////////////////////////////////////////////////////////////////
+func Min(n int) VarOption {
+	return func(v *inputVar) {
+		v.min = &n
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// The largest accepted value of an integer variable, or the longest accepted //
+// length of a string variable.                                               //
+////////////////////////////////////////////////////////////////////////////////
+func Max(n int) VarOption {
+	return func(v *inputVar) {
+		v.max = &n
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// A regular expression that the value of a string variable must match.       //
+////////////////////////////////////////////////////////////////////////////////
+func Pattern(expr string) VarOption {
+	re := regexp.MustCompile(expr)
+	return func(v *inputVar) {
+		v.pattern = re
+	}
+}
+
+func newInputVar(typ, name, desc string, required bool, opts []VarOption) inputVar {
+	v := inputVar{
+		typ:      typ,
+		name:     name,
+		desc:     desc,
+		required: required,
+	}
+	for _, opt := range opts {
+		opt(&v)
+	}
+	if v.def != nil {
+		if _, ferr := v.parse(*v.def); ferr != nil {
+			log.Critical("The default value of '%s' is invalid: %s", name, ferr.Message)
+		}
+	}
+	return v
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Convert the raw value of a variable to its declared type, and check it     //
+// against the constraints of the variable.                                   //
+////////////////////////////////////////////////////////////////////////////////
+func (v inputVar) parse(raw string) (interface{}, *FieldError) {
+	invalid := func(rule, format string, args ...interface{}) (interface{}, *FieldError) {
+		return nil, &FieldError{Field: v.name, Rule: rule, Message: fmt.Sprintf(format, args...)}
+	}
+
+	switch v.typ {
+	case varInteger:
+		i, err := strconv.Atoi(raw)
+		if err != nil {
+			return invalid("type", "'%s' must be an integer.", v.name)
+		}
+		if v.min != nil && i < *v.min {
+			return invalid("min", "'%s' must be at least %d.", v.name, *v.min)
+		}
+		if v.max != nil && i > *v.max {
+			return invalid("max", "'%s' must be at most %d.", v.name, *v.max)
+		}
+		return i, nil
+	case varBoolean:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return invalid("type", "'%s' must be true or false.", v.name)
+		}
+		return b, nil
+	case varTime:
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return invalid("type", "'%s' must be an RFC 3339 time.", v.name)
+		}
+		return t, nil
+	case varEnum:
+		for _, e := range v.enum {
+			if raw == e {
+				return raw, nil
+			}
+		}
+		return invalid("enum", "'%s' must be one of: %s.", v.name, strings.Join(v.enum, ", "))
+	case varUUID:
+		if !uuidPattern.MatchString(raw) {
+			return invalid("type", "'%s' must be a UUID.", v.name)
+		}
+		return strings.ToLower(raw), nil
+	}
+
+	if v.min != nil && len(raw) < *v.min {
+		return invalid("min", "'%s' must be at least %d characters long.", v.name, *v.min)
+	}
+	if v.max != nil && len(raw) > *v.max {
+		return invalid("max", "'%s' must be at most %d characters long.", v.name, *v.max)
+	}
+	if v.pattern != nil && !v.pattern.MatchString(raw) {
+		return invalid("pattern", "'%s' must match the pattern %s.", v.name, v.pattern.String())
+	}
+	return raw, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Parse and validate all of the path and query variables of the call. Every  //
+// problem is collected, so that the client can fix all of them at once. The  //
+// parsed values are stored in the CallData and can be read using Params().   //
+// Variables of the path that were not declared are stored as strings, so     //
+// handlers never have to read them from the router.                          //
+////////////////////////////////////////////////////////////////////////////////
+func (cdm *callDataModel) parseVars(r *http.Request, d CallData) *Error {
+	params := make(Params)
+	var problems []FieldError
+
+	vars := mux.Vars(r)
+	for name, raw := range vars {
+		params[name] = raw
+	}
+	for _, pathVar := range cdm.pathVars {
+		delete(params, pathVar.name)
+		if ferr := parseVar(pathVar, vars[pathVar.name], params); ferr != nil {
+			problems = append(problems, *ferr)
+		}
+	}
+	// Only the query is read, r.FormValue would also read a form body
+	query := r.URL.Query()
+	for _, queryVar := range cdm.queryVars {
+		if ferr := parseVar(queryVar, query.Get(queryVar.name), params); ferr != nil {
+			problems = append(problems, *ferr)
+		}
+	}
+	paramsKey.Set(d, params)
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return ErrValidation("Failed while validating request variables.", problems, ERR_INVALID_PARAM)
+}
+
+func parseVar(v inputVar, raw string, params Params) *FieldError {
+	if raw == "" {
+		if v.def != nil {
+			raw = *v.def
+		} else if v.required {
+			return &FieldError{Field: v.name, Rule: sleepyRequired, Message: "Required variable '" + v.name + "' is missing."}
+		} else {
+			return nil
+		}
+	}
+	val, ferr := v.parse(raw)
+	if ferr != nil {
+		return ferr
+	}
+	params[v.name] = val
+	return nil
+}
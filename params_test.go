@@ -0,0 +1,66 @@
+package sleepy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParams(t *testing.T) {
+	// The handler returns the parsed variables with their Go types
+	typed := func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+		p := d.Params()
+		return map[string]interface{}{
+			"id":      p.Int("id"),
+			"uuid":    p.String("uuid"),
+			"name":    p.String("name"),
+			"limit":   p.Int("limit"),
+			"active":  p.Bool("active"),
+			"since":   p.Time("since").Format(time.RFC3339),
+			"sort":    p.String("sort"),
+			"hasName": p.Has("name"),
+		}, nil
+	}
+	res := NewResource("/vars")
+	res.Route("/{id}/{uuid}").Method("GET").Returns(map[string]interface{}{}).
+		PathParamInt("id", "", Min(1), Max(100)).
+		PathParamUUID("uuid", "").
+		QueryVar("name", "", false, Min(2), Max(5), Pattern("^[a-z]+$")).
+		QueryVarInt("limit", "", false, Default("10"), Min(1), Max(50)).
+		QueryVarBool("active", "", false).
+		QueryVarTime("since", "", false).
+		QueryVarEnum("sort", "", false, []string{"asc", "desc"}).
+		To(typed)
+	res.Route("/required").Method("POST").Returns(map[string]interface{}{}).
+		QueryVarInt("limit", "", true).
+		To(typed)
+
+	const uuid = "0A1B2C3D-0000-4000-8000-00000000000F"
+	get := func(title, url string, check responseCheck) httpCase {
+		return httpCase{title: title, url: "/api/vars/" + url, status: http.StatusOK, check: check}
+	}
+	invalid := func(title, url string, fields ...string) httpCase {
+		return httpCase{title: title, url: "/api/vars/" + url, status: http.StatusUnprocessableEntity,
+			check: all(hasJSON("code", float64(ERR_INVALID_PARAM)), hasFieldErrors(fields...))}
+	}
+	runCases(t, newTestAPI(t, res), []httpCase{
+		get("path", "7/"+uuid, all(hasJSON("id", 7.0), hasJSON("uuid", "0a1b2c3d-0000-4000-8000-00000000000f"))),
+		get("defaults", "7/"+uuid, all(hasJSON("limit", 10.0), hasJSON("hasName", false), hasJSON("active", false))),
+		get("query", "7/"+uuid+"?name=abc&limit=50&active=1&since=2001-02-03T04:05:06Z&sort=desc", all(
+			hasJSON("name", "abc"), hasJSON("hasName", true), hasJSON("limit", 50.0), hasJSON("active", true),
+			hasJSON("since", "2001-02-03T04:05:06Z"), hasJSON("sort", "desc"),
+		)),
+		get("empty value uses the default", "7/"+uuid+"?limit=", hasJSON("limit", 10.0)),
+		invalid("path types", "x/not-a-uuid", "id:type", "uuid:type"),
+		invalid("path bounds", "101/"+uuid, "id:max"),
+		invalid("every problem", "0/"+uuid+"?name=ABC&limit=51&active=maybe&since=yesterday&sort=up",
+			"id:min", "name:pattern", "limit:max", "active:type", "since:type", "sort:enum"),
+		invalid("string length", "7/"+uuid+"?name=a", "name:min"),
+		invalid("string too long", "7/"+uuid+"?name=abcdef", "name:max"),
+		invalid("integer below the minimum", "7/"+uuid+"?limit=0", "limit:min"),
+		{title: "required", method: "POST", url: "/api/vars/required", status: http.StatusUnprocessableEntity, check: hasFieldErrors("limit:required")},
+		{title: "form body isn't the query", method: "POST", url: "/api/vars/required", body: "limit=5",
+			headers: []string{"Content-Type", "application/x-www-form-urlencoded"}, status: http.StatusUnprocessableEntity, check: hasFieldErrors("limit:required")},
+		{title: "required sent", method: "POST", url: "/api/vars/required?limit=5", status: http.StatusOK, check: hasJSON("limit", 5.0)},
+	})
+}
@@ -0,0 +1,556 @@
+package sleepy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	mediaMergePatch = "application/merge-patch+json"
+	mediaJSONPatch  = "application/json-patch+json"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// The body of a PATCH call, see Call.Patch. It is either a JSON Merge Patch  //
+// (RFC 7396) or a JSON Patch (RFC 6902) against the Reads() model. Handlers  //
+// can ask which fields the patch touches, or apply it onto the current       //
+// version of the resource:                                                   //
+//                                                                            //
+//   user := loadUser(d.Params().String("uid"))                               //
+//   if err := d.Patch().Apply(user); err != nil {                            //
+//       return nil, err                                                      //
+//   }                                                                        //
+////////////////////////////////////////////////////////////////////////////////
+type Patch struct {
+	call      *Call
+	mediaType string
+	merge     interface{}
+	ops       []patchOp
+	present   fieldSet
+}
+
+// A single operation of a JSON Patch.
+type patchOp struct {
+	op       string
+	path     []string
+	from     []string
+	value    interface{}
+	hasValue bool
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Make the call a PATCH call of its Reads() model. The request body can be a //
+// JSON Merge Patch, sent as application/merge-patch+json or plain JSON, or a //
+// JSON Patch, sent as application/json-patch+json. Before the handler runs,  //
+// read-only fields are rejected if the patch touches them at all, and the    //
+// values in a merge patch are checked against the constraint tags. The patch //
+// is stored in the CallData, see CallData.Patch, and for merge patches the   //
+// body is decoded into the model too.                                        //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) Patch() *Call {
+	c.method = "PATCH"
+	c.patch = true
+	return c
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Get the patch of a PATCH call from the CallData.                           //
+////////////////////////////////////////////////////////////////////////////////
+func (d CallData) Patch() *Patch {
+	return patchKey.Value(d)
+}
+
+// The media type of the patch, application/merge-patch+json or
+// application/json-patch+json.
+func (p *Patch) MediaType() string {
+	return p.mediaType
+}
+
+// Check if the patch sets, removes, or changes anything inside the field. The
+// field is named by its JSON path, e.g. "address.zip".
+func (p *Patch) Has(field string) bool {
+	return p.present.has(field)
+}
+
+// The JSON paths of all of the fields that the patch touches, sorted.
+func (p *Patch) Fields() []string {
+	fields := make([]string, 0, len(p.present))
+	for f := range p.present {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Apply the patch onto target, which must be a pointer to a value of the     //
+// Reads() model. The patched value is checked against all of the tags of the //
+// model, including required, before target is changed. If the patch can't be //
+// applied, or the result is invalid, target is left as it was and a 422      //
+// Error is returned, which the handler can return as it is. Fields that      //
+// aren't part of the JSON of the model, like json:"-" and unexported fields, //
+// keep the values they had in target.                                        //
+////////////////////////////////////////////////////////////////////////////////
+func (p *Patch) Apply(target interface{}) error {
+	model := reflect.TypeOf(p.call.model.bodyIn.model)
+	tv := reflect.ValueOf(target)
+	if tv.Kind() != reflect.Ptr || tv.IsNil() || tv.Elem().Type() != model {
+		return ErrInternal(fmt.Sprintf("Patch.Apply needs a non-nil *%s, not %T.", model, target))
+	}
+
+	doc, err := toJSONTree(target)
+	if err != nil {
+		return ErrInternal("Could not marshal the target of the patch: " + err.Error())
+	}
+	if p.mediaType == mediaMergePatch {
+		doc = mergePatch(doc, p.merge)
+	} else {
+		for i, op := range p.ops {
+			if doc, err = op.apply(doc); err != nil {
+				return ErrBadRequest(err.Error(), "Operation "+strconv.Itoa(i)+" of the JSON Patch could not be applied.", ERR_PATCH_FAILED)
+			}
+		}
+	}
+
+	jb, err := json.Marshal(doc)
+	if err != nil {
+		return ErrInternal("Could not marshal the patched document: " + err.Error())
+	}
+	patched := reflect.New(model)
+	if err := json.Unmarshal(jb, patched.Interface()); err != nil {
+		return ErrBadRequest(err.Error(), "The patched resource does not fit the model.", ERR_PATCH_FAILED)
+	}
+	// Required fields are set if their key is in the patched document, even
+	// with a false, 0 or "" value
+	present := make(fieldSet)
+	(&presenceWalk{present: present}).value(model, "", doc)
+	problems := p.call.model.bodyIn.rules.validate(patched, "", tagMode{require: true, present: present}, nil)
+	if len(problems) > 0 {
+		return ErrValidation("Failed while validating the patched resource.", problems, ERR_INVALID_FIELD)
+	}
+	// Only the fields that JSON knows about are patched, the others, like
+	// json:"-" and unexported fields, keep the values of the target
+	result := reflect.New(model).Elem()
+	result.Set(tv.Elem())
+	copyJSONFields(result, patched.Elem())
+	tv.Elem().Set(result)
+	return nil
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// copyJSONFields copies the fields of the struct src that encoding/json fills
+// onto dst, and leaves the other fields of dst as they are. Structs inside are
+// copied the same way, unless they decode themselves, like time.Time.
+func copyJSONFields(dst, src reflect.Value) {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		df := dst.Field(i)
+		if _, ok := jsonFieldName(field); !ok || !df.CanSet() {
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct && !reflect.PtrTo(field.Type).Implements(jsonUnmarshalerType) {
+			copyJSONFields(df, src.Field(i))
+			continue
+		}
+		df.Set(src.Field(i))
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Read the body of a PATCH call into a Patch, and reject read-only fields    //
+// and values that break the constraint tags of the model.                    //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) decodePatch(w http.ResponseWriter, r *http.Request, d CallData) *Error {
+	mediaType := mediaMergePatch
+	if header := r.Header.Get("Content-Type"); header != "" {
+		mt, _, err := mime.ParseMediaType(header)
+		if err != nil || (mt != mediaMergePatch && mt != mediaJSONPatch && mt != "application/json") {
+			return ErrUnsupportedMediaType(header)
+		}
+		if mt == mediaJSONPatch {
+			mediaType = mt
+		}
+	}
+
+	var raw json.RawMessage
+	if apiErr := c.decodeBody(w, r, JSONCodec, &raw); apiErr != nil {
+		return apiErr
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var tree interface{}
+	if err := dec.Decode(&tree); err != nil {
+		return ErrBadRequest(err.Error(), "Could not parse the request.", ERR_PARSE_REQUEST)
+	}
+
+	model := reflect.TypeOf(c.model.bodyIn.model)
+	p := &Patch{call: c, mediaType: mediaType, present: make(fieldSet)}
+	walk := &presenceWalk{present: p.present, readonly: true}
+	if mediaType == mediaMergePatch {
+		if _, ok := tree.(map[string]interface{}); !ok {
+			return ErrBadRequest("The merge patch is not an object.", "The merge patch must be a JSON object.", ERR_INVALID_PATCH)
+		}
+		p.merge = tree
+		walk.value(model, "", tree)
+	} else {
+		ops, err := parsePatchOps(tree)
+		if err != nil {
+			return ErrBadRequest(err.Error(), "The JSON Patch is invalid.", ERR_INVALID_PATCH)
+		}
+		p.ops = ops
+		for _, op := range ops {
+			// A test doesn't change anything, e.g. it may compare a read-only id.
+			if op.op == "test" {
+				continue
+			}
+			t, path := walk.pointer(model, op.path)
+			if op.hasValue {
+				walk.value(t, path, op.value)
+			}
+			if op.op == "move" {
+				walk.pointer(model, op.from)
+			}
+		}
+	}
+	if len(walk.problems) > 0 {
+		return ErrValidation("Failed while validating the patch.", walk.problems, ERR_INVALID_FIELD)
+	}
+
+	// The values of a merge patch can be checked before it is applied
+	if mediaType == mediaMergePatch {
+		payload := reflect.New(model).Interface()
+		opts := c.decodeOptions()
+		err := jsonCodec{}.DecodeWithOptions(bytes.NewReader(raw), payload, DecodeOptions{
+			DisallowUnknownFields: opts.DisallowUnknownFields,
+			UseNumber:             opts.UseNumber,
+		})
+		if err != nil {
+			return decodeError(err)
+		}
+		// Fields set to null are removed, whether that is allowed is up to
+		// the required check when the patch is applied
+		problems := c.model.bodyIn.rules.validate(reflect.ValueOf(payload), "", tagMode{present: p.present}, nil)
+		if len(problems) > 0 {
+			return ErrValidation("Failed while validating tags for the payload.", problems, ERR_INVALID_FIELD)
+		}
+		bodyKey.Set(d, payload)
+	}
+	patchKey.Set(d, p)
+	return nil
+}
+
+func parsePatchOps(tree interface{}) ([]patchOp, error) {
+	list, ok := tree.([]interface{})
+	if !ok {
+		return nil, errors.New("a JSON Patch must be an array of operations")
+	}
+	ops := make([]patchOp, len(list))
+	for i, item := range list {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("operation %d is not an object", i)
+		}
+		op := &ops[i]
+		op.op, _ = obj["op"].(string)
+		op.value, op.hasValue = obj["value"]
+		path, ok := obj["path"].(string)
+		if !ok {
+			return nil, fmt.Errorf("operation %d has no path", i)
+		}
+		var err error
+		if op.path, err = parsePointer(path); err != nil {
+			return nil, fmt.Errorf("operation %d: %s", i, err)
+		}
+		switch op.op {
+		case "add", "replace", "test":
+			if !op.hasValue {
+				return nil, fmt.Errorf("operation %d (%s) has no value", i, op.op)
+			}
+		case "remove":
+		case "move", "copy":
+			from, ok := obj["from"].(string)
+			if !ok {
+				return nil, fmt.Errorf("operation %d (%s) has no from", i, op.op)
+			}
+			if op.from, err = parsePointer(from); err != nil {
+				return nil, fmt.Errorf("operation %d: %s", i, err)
+			}
+		default:
+			return nil, fmt.Errorf("operation %d has the unknown op '%s'", i, op.op)
+		}
+	}
+	return ops, nil
+}
+
+// parsePointer splits a JSON pointer (RFC 6901) into its unescaped tokens.
+func parsePointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+	if ptr[0] != '/' {
+		return nil, errors.New("the JSON pointer '" + ptr + "' does not start with /")
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func formatPointer(tokens []string) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteString("/" + strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1))
+	}
+	return b.String()
+}
+
+// apply runs the operation on the document and returns the new document.
+func (op patchOp) apply(doc interface{}) (interface{}, error) {
+	switch op.op {
+	case "add":
+		return pointerSet(doc, op.path, deepCopy(op.value), false)
+	case "replace":
+		return pointerSet(doc, op.path, deepCopy(op.value), true)
+	case "remove":
+		doc, _, err := pointerRemove(doc, op.path)
+		return doc, err
+	case "move":
+		if len(op.path) > len(op.from) && formatPointer(op.path[:len(op.from)]) == formatPointer(op.from) {
+			return nil, errors.New("cannot move " + formatPointer(op.from) + " into itself")
+		}
+		doc, v, err := pointerRemove(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return pointerSet(doc, op.path, v, false)
+	case "copy":
+		v, err := pointerGet(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return pointerSet(doc, op.path, deepCopy(v), false)
+	case "test":
+		v, err := pointerGet(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(v, op.value) {
+			return nil, errors.New("the test of " + formatPointer(op.path) + " failed")
+		}
+	}
+	return doc, nil
+}
+
+func pointerGet(doc interface{}, tokens []string) (interface{}, error) {
+	for i, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[token]
+			if !ok {
+				return nil, errors.New(formatPointer(tokens[:i+1]) + " does not exist")
+			}
+			doc = v
+		case []interface{}:
+			idx, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, errors.New(formatPointer(tokens[:i+1]) + ": " + err.Error())
+			}
+			doc = node[idx]
+		default:
+			return nil, errors.New(formatPointer(tokens[:i+1]) + " does not exist")
+		}
+	}
+	return doc, nil
+}
+
+// pointerSet adds or replaces the value at the pointer. Adding to an array
+// inserts the value, replacing requires the value to exist.
+func pointerSet(doc interface{}, tokens []string, value interface{}, replace bool) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parent, err := pointerGet(doc, tokens[:len(tokens)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := node[token]; replace && !ok {
+			return nil, errors.New(formatPointer(tokens) + " does not exist")
+		}
+		node[token] = value
+		return doc, nil
+	case []interface{}:
+		idx, err := arrayIndex(token, len(node), !replace)
+		if err != nil {
+			return nil, errors.New(formatPointer(tokens) + ": " + err.Error())
+		}
+		if replace {
+			node[idx] = value
+			return doc, nil
+		}
+		node = append(node, nil)
+		copy(node[idx+1:], node[idx:])
+		node[idx] = value
+		// The array grew, so it has to be stored in its parent again.
+		return pointerSet(doc, tokens[:len(tokens)-1], node, true)
+	}
+	return nil, errors.New(formatPointer(tokens[:len(tokens)-1]) + " is not an object or array")
+}
+
+// pointerRemove removes the value at the pointer, and returns the new document
+// and the removed value.
+func pointerRemove(doc interface{}, tokens []string) (interface{}, interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, nil, errors.New("the whole document cannot be removed")
+	}
+	parent, err := pointerGet(doc, tokens[:len(tokens)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	token := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		v, ok := node[token]
+		if !ok {
+			return nil, nil, errors.New(formatPointer(tokens) + " does not exist")
+		}
+		delete(node, token)
+		return doc, v, nil
+	case []interface{}:
+		idx, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, nil, errors.New(formatPointer(tokens) + ": " + err.Error())
+		}
+		v := node[idx]
+		node = append(node[:idx:idx], node[idx+1:]...)
+		doc, err = pointerSet(doc, tokens[:len(tokens)-1], node, true)
+		return doc, v, err
+	}
+	return nil, nil, errors.New(formatPointer(tokens[:len(tokens)-1]) + " is not an object or array")
+}
+
+// arrayIndex parses an array index token. When adding, the index may be one
+// past the end, which can also be written as "-".
+func arrayIndex(token string, length int, add bool) (int, error) {
+	if add && token == "-" {
+		return length, nil
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || (token != "0" && token[0] == '0') {
+		return 0, errors.New("'" + token + "' is not an array index")
+	}
+	if idx > length || (!add && idx == length) {
+		return 0, errors.New("index " + token + " is out of bounds")
+	}
+	return idx, nil
+}
+
+// mergePatch applies a JSON Merge Patch (RFC 7396) to the target.
+func mergePatch(target, patch interface{}) interface{} {
+	obj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for key, v := range obj {
+		if v == nil {
+			delete(t, key)
+		} else {
+			t[key] = mergePatch(t[key], v)
+		}
+	}
+	return t
+}
+
+// toJSONTree converts v to the generic values of encoding/json, keeping the
+// exact value of numbers.
+func toJSONTree(v interface{}) (interface{}, error) {
+	jb, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(jb))
+	dec.UseNumber()
+	var tree interface{}
+	err = dec.Decode(&tree)
+	return tree, err
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, e := range v {
+			c[key] = deepCopy(e)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = deepCopy(e)
+		}
+		return c
+	}
+	return v
+}
+
+// jsonEqual compares two generic JSON values, treating numbers by value, so
+// that 1 and 1.0 are equal.
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		bn, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		// Integers are compared exactly, they may not fit a float64. Any
+		// other number is compared as a float, so that 1 equals 1.0.
+		ai, aerr := a.Int64()
+		bi, berr := bn.Int64()
+		if aerr == nil && berr == nil {
+			return ai == bi
+		}
+		af, aerr := a.Float64()
+		bf, berr := bn.Float64()
+		return aerr == nil && berr == nil && af == bf
+	case map[string]interface{}:
+		bm, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(bm) {
+			return false
+		}
+		for key, e := range a {
+			if be, ok := bm[key]; !ok || !jsonEqual(e, be) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bl, ok := b.([]interface{})
+		if !ok || len(a) != len(bl) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], bl[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
@@ -0,0 +1,90 @@
+package sleepy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type patchUser struct {
+	ID      string       `json:"id" sleepy:"readonly"`
+	Name    string       `json:"name" sleepy:"required"`
+	Active  bool         `json:"active" sleepy:"required"`
+	Age     int          `json:"age" sleepy:"required"`
+	Born    time.Time    `json:"born"`
+	Address patchAddress `json:"address"`
+	Hash    string       `json:"-"`
+	version int
+}
+
+type patchAddress struct {
+	City string `json:"city"`
+	Geo  string `json:"-"`
+}
+
+func TestPatch(t *testing.T) {
+	// The patch is applied onto a stored user, and the result returned
+	res := NewResource("/users")
+	res.Route("").Patch().Reads(patchUser{}).Returns(patchUser{}).
+		To(func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+			user := &patchUser{ID: "1", Name: "Ann", Active: true, Age: 30, Hash: "bcrypt", version: 7}
+			user.Address = patchAddress{City: "Oslo", Geo: "59.9,10.7"}
+			if err := d.Patch().Apply(user); err != nil {
+				return nil, err
+			}
+			// The fields that aren't sent as JSON are checked in a header
+			w.Header().Set("X-Hidden", fmt.Sprintf("%s %s %d", user.Hash, user.Address.Geo, user.version))
+			return user, nil
+		})
+	merge := func(title, patch string, status int, check responseCheck) httpCase {
+		return httpCase{title: "merge " + title, method: "PATCH", url: "/api/users", body: patch, headers: []string{"Content-Type", mediaMergePatch}, status: status, check: check}
+	}
+	jsonPatch := func(title, patch string, status int, check responseCheck) httpCase {
+		return httpCase{title: "json " + title, method: "PATCH", url: "/api/users", body: patch, headers: []string{"Content-Type", mediaJSONPatch}, status: status, check: check}
+	}
+	runCases(t, newTestAPI(t, res), []httpCase{
+		merge("false", `{"active": false}`, http.StatusOK, hasJSON("active", false)),
+		merge("keeps hidden fields", `{"name": "Bo", "address": {"city": "Bergen"}}`, http.StatusOK, all(hasJSON("name", "Bo"), hasHeader("X-Hidden", "bcrypt 59.9,10.7 7"))),
+		merge("time", `{"born": "2001-02-03T04:05:06Z"}`, http.StatusOK, hasJSON("born", "2001-02-03T04:05:06Z")),
+		merge("zero", `{"age": 0}`, http.StatusOK, hasJSON("age", 0.0)),
+		merge("empty string", `{"name": ""}`, http.StatusOK, hasJSON("name", "")),
+		merge("removed required", `{"name": null}`, http.StatusUnprocessableEntity, hasFieldErrors("name:required")),
+		merge("read-only", `{"id": "2"}`, http.StatusUnprocessableEntity, hasFieldErrors("id:readonly")),
+		merge("not an object", `[1]`, http.StatusUnprocessableEntity, nil),
+
+		jsonPatch("replace", `[{"op": "replace", "path": "/age", "value": 31}]`, http.StatusOK, all(hasJSON("age", 31.0), hasHeader("X-Hidden", "bcrypt 59.9,10.7 7"))),
+		jsonPatch("test integer", `[{"op": "test", "path": "/age", "value": 30}, {"op": "replace", "path": "/name", "value": "Bo"}]`, http.StatusOK, hasJSON("name", "Bo")),
+		jsonPatch("test float", `[{"op": "test", "path": "/age", "value": 30.0}, {"op": "replace", "path": "/name", "value": "Bo"}]`, http.StatusOK, hasJSON("name", "Bo")),
+		jsonPatch("test exponent", `[{"op": "test", "path": "/age", "value": 3e1}, {"op": "replace", "path": "/name", "value": "Bo"}]`, http.StatusOK, hasJSON("name", "Bo")),
+		jsonPatch("test read-only", `[{"op": "test", "path": "/id", "value": "1"}]`, http.StatusOK, hasJSON("id", "1")),
+		jsonPatch("test failure", `[{"op": "test", "path": "/name", "value": "Bob"}]`, http.StatusUnprocessableEntity, hasJSON("code", float64(ERR_PATCH_FAILED))),
+		jsonPatch("test number failure", `[{"op": "test", "path": "/age", "value": 30.5}]`, http.StatusUnprocessableEntity, hasJSON("code", float64(ERR_PATCH_FAILED))),
+		jsonPatch("remove required", `[{"op": "remove", "path": "/name"}]`, http.StatusUnprocessableEntity, hasFieldErrors("name:required")),
+		jsonPatch("replace read-only", `[{"op": "replace", "path": "/id", "value": "2"}]`, http.StatusUnprocessableEntity, hasFieldErrors("id:readonly")),
+		jsonPatch("missing path", `[{"op": "replace", "path": "/nothing/here", "value": 1}]`, http.StatusUnprocessableEntity, nil),
+		jsonPatch("unknown op", `[{"op": "frobnicate", "path": "/age"}]`, http.StatusUnprocessableEntity, hasJSON("code", float64(ERR_INVALID_PATCH))),
+	})
+}
+
+func TestJSONEqual(t *testing.T) {
+	tests := []struct {
+		a, b  interface{}
+		equal bool
+	}{
+		{json.Number("1"), json.Number("1.0"), true},
+		{json.Number("1.0"), json.Number("1"), true},
+		{json.Number("100"), json.Number("1e2"), true},
+		{json.Number("9007199254740993"), json.Number("9007199254740992"), false},
+		{json.Number("1"), json.Number("1.5"), false},
+		{json.Number("1"), "1", false},
+		{map[string]interface{}{"a": json.Number("1")}, map[string]interface{}{"a": json.Number("1.0")}, true},
+		{[]interface{}{json.Number("1")}, []interface{}{json.Number("2")}, false},
+	}
+	for _, test := range tests {
+		if got := jsonEqual(test.a, test.b); got != test.equal {
+			t.Errorf("jsonEqual(%v, %v) = %v, want %v", test.a, test.b, got, test.equal)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package sleepy
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// fieldSet holds the JSON paths of the fields that are present in a request
+// body, named like the fields of validation errors, e.g. "items[0].name". A
+// field that is present with a null value maps to false.
+type fieldSet map[string]bool
+
+// has reports if the key of the field was present, even with a null value.
+func (fs fieldSet) has(path string) bool {
+	_, ok := fs[path]
+	return ok
+}
+
+// hasValue reports if the field was present with a value other than null.
+func (fs fieldSet) hasValue(path string) bool {
+	return fs[path]
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// presenceWalk follows a request body, or the paths and values of a patch,   //
+// through the model type to record which fields are present. Keys that       //
+// aren't in the model are recorded as they are. If readonly is set, the      //
+// read-only fields among them are collected as problems right away, which a  //
+// patch needs since it may touch a field without giving it a value.          //
+////////////////////////////////////////////////////////////////////////////////
+type presenceWalk struct {
+	present  fieldSet
+	readonly bool
+	problems []FieldError
+}
+
+// pointer walks the tokens of a JSON pointer and returns the type and path of
+// the value it points at. The type is nil if the pointer leaves the model.
+func (pw *presenceWalk) pointer(t reflect.Type, tokens []string) (reflect.Type, string) {
+	path := ""
+	for _, token := range tokens {
+		if t != nil {
+			t = indirectType(t)
+		}
+		switch {
+		case t == nil:
+			path = joinPath(path, token)
+		case t.Kind() == reflect.Struct:
+			var ok bool
+			if t, path, ok = pw.field(t, path, token); !ok {
+				return nil, path
+			}
+		case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+			path += "[" + token + "]"
+			t = t.Elem()
+		case t.Kind() == reflect.Map:
+			path = joinPath(path, token)
+			t = t.Elem()
+		default:
+			path, t = joinPath(path, token), nil
+		}
+		pw.present[path] = true
+	}
+	return t, path
+}
+
+// value records the fields inside a value that is written at path.
+func (pw *presenceWalk) value(t reflect.Type, path string, v interface{}) {
+	if path != "" {
+		pw.present[path] = v != nil
+	}
+	if t != nil {
+		t = indirectType(t)
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, e := range v {
+			et, ep := reflect.Type(nil), joinPath(path, key)
+			switch {
+			case t != nil && t.Kind() == reflect.Struct:
+				var ok bool
+				if et, ep, ok = pw.field(t, path, key); !ok {
+					continue
+				}
+			case t != nil && t.Kind() == reflect.Map:
+				et = t.Elem()
+			}
+			pw.value(et, ep, e)
+		}
+	case []interface{}:
+		var et reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			et = t.Elem()
+		}
+		for i, e := range v {
+			pw.value(et, fmt.Sprintf("%s[%d]", path, i), e)
+		}
+	}
+}
+
+// field finds the field of struct type t with the JSON name, and returns its
+// type and path. If readonly is set, it returns false for read-only fields,
+// which are then recorded as problems.
+func (pw *presenceWalk) field(t reflect.Type, path, name string) (reflect.Type, string, bool) {
+	f, ok := jsonField(t, name)
+	if !ok {
+		return nil, joinPath(path, name), true
+	}
+	fname, _ := jsonFieldName(f)
+	path = joinPath(path, fname)
+	if pw.readonly && hasSleepyTag(f, sleepyReadOnly) {
+		pw.present[path] = true
+		pw.problems = append(pw.problems, FieldError{Field: path, Rule: sleepyReadOnly, Message: "Attempting to set read-only field: " + path + "."})
+		return nil, path, false
+	}
+	return f.Type, path, true
+}
+
+// jsonField finds the field that encoding/json would decode the key into,
+// looking inside embedded structs, and ignoring case like encoding/json.
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := jsonFieldName(f)
+		if !ok {
+			continue
+		}
+		if ft := indirectType(f.Type); f.Anonymous && ft.Kind() == reflect.Struct && f.Tag.Get("json") == "" {
+			if ef, ok := jsonField(ft, key); ok {
+				return ef, true
+			}
+			continue
+		}
+		if strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
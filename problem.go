@@ -0,0 +1,97 @@
+package sleepy
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// An RFC 7807 problem details object. The standard members are followed by   //
+// the sleepy error code and the field errors of validation failures as       //
+// extension members.                                                         //
+////////////////////////////////////////////////////////////////////////////////
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     int          `json:"code,omitempty"`
+	Fields   []FieldError `json:"fields,omitempty"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Errors can implement ProblemDetailer to control every member of the        //
+// problem that RenderProblemJSON writes, for example to set a type URI.      //
+////////////////////////////////////////////////////////////////////////////////
+type ProblemDetailer interface {
+	ProblemDetails() *Problem
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Switch the API to write every error, including the validation, parse, not  //
+// found and method not allowed errors of sleepy itself, as an RFC 7807       //
+// application/problem+json response. The OpenAPI document is updated to      //
+// describe the Problem model as the error response.                          //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) UseProblemDetails() {
+	api.errorRenderer = RenderProblemJSON
+	api.problemDetails = true
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// The ErrorRenderer used by UseProblemDetails. Members that the error does   //
+// not provide are filled in from the response: the type defaults to          //
+// about:blank, the title to the text of the status code, and the instance    //
+// to the path of the request. The detail of other errors than *Error is      //
+// only set if their Body is a string, since their Error text is not meant    //
+// for the client.                                                            //
+////////////////////////////////////////////////////////////////////////////////
+func RenderProblemJSON(w http.ResponseWriter, r *http.Request, e HTTPError) {
+	var p Problem
+	if pd, ok := e.(ProblemDetailer); ok {
+		p = *pd.ProblemDetails()
+	} else {
+		p = problemFromBody(e.Body())
+	}
+	if p.Status == 0 {
+		p.Status = e.StatusCode()
+	}
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+
+	jb, err := json.Marshal(p)
+	if err != nil {
+		log.Critical("%s", err.Error())
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	w.Write(jb)
+}
+
+// problemFromBody fills in the members of a problem that the body of an error
+// provides.
+func problemFromBody(body interface{}) Problem {
+	var p Problem
+	switch b := body.(type) {
+	case *Error:
+		p.Detail = b.Msg
+		if p.Detail == "" {
+			p.Detail = b.Err
+		}
+		p.Code = b.Code
+		p.Fields = b.Fields
+	case string:
+		p.Detail = b
+	}
+	return p
+}
@@ -0,0 +1,81 @@
+package sleepy
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// An error whose Error text is internal, and whose body isn't a string.
+type internalError struct{}
+
+func (internalError) Error() string     { return "connecting to db at 10.0.0.1" }
+func (internalError) StatusCode() int   { return http.StatusConflict }
+func (internalError) Body() interface{} { return map[string]string{"reason": "conflict"} }
+
+// An error whose body is the text for the client.
+type textError struct{}
+
+func (textError) Error() string     { return "internal text" }
+func (textError) StatusCode() int   { return http.StatusGone }
+func (textError) Body() interface{} { return "the item is gone" }
+
+// An error that sets every member of the problem itself.
+type detailedError struct{ textError }
+
+func (detailedError) ProblemDetails() *Problem {
+	return &Problem{Type: "https://example.com/gone", Title: "Gone for good", Detail: "moved away", Instance: "/items/1"}
+}
+
+func TestProblemDetails(t *testing.T) {
+	type item struct {
+		Name string `json:"name" sleepy:"required"`
+	}
+	res := NewResource("/items")
+	res.Route("").Method("POST").Reads(item{}).Returns(item{}).To(echo)
+	res.Route("/internal").Method("GET").Returns(item{}).To(returns(nil, internalError{}))
+	res.Route("/text").Method("GET").Returns(item{}).To(returns(nil, textError{}))
+	res.Route("/detailed").Method("GET").Returns(item{}).To(returns(nil, detailedError{}))
+	res.Route("/hidden").Method("GET").Returns(item{}).To(returns(nil, errors.New("secret")))
+	api := New("/api", false)
+	api.UseProblemDetails()
+	register(t, api, res)
+
+	problem := func(status int, typ, title, detail, instance string) responseCheck {
+		checks := []responseCheck{
+			hasHeader("Content-Type", "application/problem+json"),
+			hasJSON("status", float64(status)),
+			hasJSON("type", typ),
+			hasJSON("title", title),
+			hasJSON("instance", instance),
+		}
+		if detail == "" {
+			checks = append(checks, hasJSON("detail", nil))
+		} else {
+			checks = append(checks, hasJSON("detail", detail))
+		}
+		return all(checks...)
+	}
+	runCases(t, api, []httpCase{
+		{title: "validation", method: "POST", url: "/api/items", body: `{}`, status: http.StatusUnprocessableEntity,
+			check: all(hasHeader("Content-Type", "application/problem+json"), hasJSON("title", "Unprocessable Entity"), hasFieldErrors("name:required"))},
+		{title: "not found", url: "/api/nothing", status: http.StatusNotFound,
+			check: all(hasHeader("Content-Type", "application/problem+json"), hasJSON("code", float64(ERR_NOT_FOUND)))},
+		{title: "method not allowed", method: "DELETE", url: "/api/items", status: http.StatusMethodNotAllowed,
+			check: hasHeader("Content-Type", "application/problem+json")},
+		{title: "problem+json is written for any Accept", url: "/api/items/text", headers: []string{"Accept", "application/xml"}, status: http.StatusGone,
+			check: problem(http.StatusGone, "about:blank", "Gone", "the item is gone", "/api/items/text")},
+		{title: "error text is not the detail", url: "/api/items/internal", status: http.StatusConflict,
+			check: problem(http.StatusConflict, "about:blank", "Conflict", "", "/api/items/internal")},
+		{title: "problem detailer", url: "/api/items/detailed", status: http.StatusGone,
+			check: problem(http.StatusGone, "https://example.com/gone", "Gone for good", "moved away", "/items/1")},
+		{title: "hidden", url: "/api/items/hidden", status: http.StatusInternalServerError,
+			check: all(problem(http.StatusInternalServerError, "about:blank", "Internal Server Error", "Internal server error.", "/api/items/hidden"), hasJSON("code", float64(ERR_INTERNAL)))},
+	})
+
+	// RenderErrors switches back to plain JSON errors
+	api.RenderErrors(RenderJSONError)
+	runCases(t, api, []httpCase{
+		{title: "json errors", url: "/api/items/text", status: http.StatusGone, check: hasHeader("Content-Type", "Application/JSON")},
+	})
+}
@@ -0,0 +1,54 @@
+package sleepy
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// A function that is told about every panic that sleepy recovers from, e.g.  //
+// to forward it to a crash reporter. It receives the request, the name of    //
+// the operation that panicked, the value given to panic and the stack trace. //
+// The operation is the operation name of the call, or a description of the   //
+// resource or API level if the panic happened before a call was matched.     //
+////////////////////////////////////////////////////////////////////////////////
+type PanicHandler func(r *http.Request, operation string, recovered interface{}, stack []byte)
+
+////////////////////////////////////////////////////////////////////////////////
+// Set the PanicHandler of the API. Recovered panics are always logged and    //
+// answered with an ErrInternal response, or a dropped connection if the      //
+// response was started already, whether or not a handler is set.             //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) OnPanic(h PanicHandler) {
+	api.panicHandler = h
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Deferred by the API, every Resource and every Call, so that a panicking    //
+// filter or handler is turned into a sleepy formatted 500 response. The      //
+// innermost level recovers first, so each panic is only handled once. If the //
+// handler, e.g. a mounted one, started its response before it panicked, the  //
+// panic is only logged and the connection is dropped, by panicking with      //
+// http.ErrAbortHandler, since the error can't be sent anymore.               //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) recoverPanic(w http.ResponseWriter, r *http.Request, d CallData, operation string) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+	// The net/http server uses this value to abort a response on purpose.
+	if rec == http.ErrAbortHandler {
+		panic(rec)
+	}
+	stack := debug.Stack()
+	log.Critical("Panic while handling %s: %v\n%s", operation, rec, stack)
+	if api.panicHandler != nil {
+		api.panicHandler(r, operation, rec, stack)
+	}
+	// If the response was started, an error can't be sent anymore, so the
+	// connection is dropped to tell the client that the response is broken
+	if sw := findStatusWriter(w); sw != nil && sw.status != 0 {
+		panic(http.ErrAbortHandler)
+	}
+	api.endCall(w, r, ErrInternal("The server failed while handling "+operation+"."), d)
+}
@@ -0,0 +1,48 @@
+package sleepy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	var handled []string
+	api := New("/api", false)
+	api.OnPanic(func(r *http.Request, operation string, recovered interface{}, stack []byte) {
+		handled = append(handled, operation)
+	})
+	res := NewResource("/boom")
+	res.Route("/early").Method("GET").OperationName("early").Returns(map[string]string{}).
+		To(func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+			panic("before writing")
+		})
+	res.Mount("/late", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("partial"))
+		panic("after writing")
+	})).OperationName("late")
+	register(t, api, res)
+	runCases(t, api, []httpCase{
+		{title: "panic before writing", url: "/api/boom/early", status: http.StatusInternalServerError, check: hasJSON("code", float64(ERR_INTERNAL))},
+	})
+
+	// The connection must be dropped, without an error body after the start
+	// of the response
+	w := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if rec := recover(); rec != http.ErrAbortHandler {
+				t.Errorf("panic after writing: recovered %v, want http.ErrAbortHandler", rec)
+			}
+		}()
+		api.ServeHTTP(w, httptest.NewRequest("GET", "/api/boom/late", nil))
+	}()
+	if w.Body.String() != "partial" {
+		t.Errorf("panic after writing: got body %q, want only the partial response", w.Body)
+	}
+
+	if len(handled) != 2 || handled[0] != "early" || handled[1] != "late" {
+		t.Errorf("the panic handler was told about %v, want both panics", handled)
+	}
+}
@@ -1,7 +1,10 @@
 package sleepy
 
 import (
+	"bytes"
 	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/tortis/sleepy/mux"
 )
@@ -14,11 +17,17 @@ import (
 // finally return the new resource											  //
 ////////////////////////////////////////////////////////////////////////////////
 type Resource struct {
-	path    string
-	name    string
-	calls   []*Call
-	filters []Filter
-	router  *mux.Router
+	api      *API
+	path     string
+	name     string
+	calls    []*Call
+	filters  []Filter
+	after    []AfterFilter
+	wraps    []Middleware
+	use      []func(http.Handler) http.Handler
+	router   *mux.Router
+	cors     *corsPolicy
+	security []string
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -32,7 +41,7 @@ func NewResource(path string) *Resource {
 
 // Start call builder
 func (r *Resource) Route(path string) *Call {
-	c := &Call{path: path, operationName: path, filters: make([]Filter, 0)}
+	c := &Call{resource: r, path: path, filters: make([]Filter, 0)}
 	r.calls = append(r.calls, c)
 	return c
 }
@@ -45,24 +54,109 @@ func (r *Resource) Filter(f Filter) {
 // This handler will apply any set filters and then use a subrouter to determine
 // which call handler should be used.
 // The construct() method should be called prior to serving any requests.
-func (res *Resource) ServeHTTP(w http.ResponseWriter, r *http.Request, d map[string]interface{}) {
+func (res *Resource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d := DataFromContext(r.Context())
+	defer res.api.recoverPanic(w, r, d, "resource "+res.path)
+
+	if len(res.use) > 0 {
+		chain(http.HandlerFunc(res.serve), res.use).ServeHTTP(w, r)
+	} else {
+		res.serve(w, r)
+	}
+}
+
+// serve runs the filters of the resource and routes the request to its call,
+// once the http middleware of the resource, if any, has passed it on.
+func (res *Resource) serve(w http.ResponseWriter, r *http.Request) {
+	d := DataFromContext(r.Context())
+
 	// Call all filters
 	for _, filter := range res.filters {
-		err := filter(r, d)
+		err := nilIfTypedNil(filter(r, d))
 		if err != nil {
-			endCall(w, r, err, d)
+			res.api.endCall(w, r, err, d)
 			return
 		}
 	}
 
 	// Route to the appropriate call handler
-	res.router.ServeHTTP(w, r, d)
+	res.router.ServeHTTP(w, r)
 }
 
 // Give the resource a subrouter for its base path so that it can attach its
 // call handlers to their respective paths.
 func (r *Resource) construct(pathPrefix string) {
+	r.router.MethodNotAllowedHandler = methodNotAllowed{r.api, r.router}
+	r.router.NotFoundHandler = notFound{r.api}
 	for _, call := range r.calls {
-		r.router.Handle(pathPrefix+r.path+call.path, call).Methods(call.method)
+		if call.mount == nil {
+			call.route = r.router.Handle(pathPrefix+r.path+call.path, call).Methods(call.method)
+			continue
+		}
+		call.route = r.router.PathPrefix(pathPrefix + r.path + call.path).Handler(call)
+		if call.method != "" {
+			call.route.Methods(call.method)
+		}
+	}
+}
+
+// methodNotAllowed handles requests whose path matches a call, but whose method
+// doesn't. The Allow header lists the methods of the calls registered for the
+// path. OPTIONS requests are answered with that list, everything else gets a
+// 405 error.
+type methodNotAllowed struct {
+	api    *API
+	router *mux.Router
+}
+
+func (h methodNotAllowed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d := DataFromContext(r.Context())
+	methods := h.router.AllowedMethods(r)
+	if i := sort.SearchStrings(methods, "OPTIONS"); i == len(methods) || methods[i] != "OPTIONS" {
+		methods = append(methods, "OPTIONS")
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusNoContent)
+		h.api.endCall(w, r, nil, d)
+		return
+	}
+	h.api.endCall(w, r, ErrMethodNotAllowed(r.Method), d)
+}
+
+// notFound handles requests that don't match any resource or call, using the
+// handler set with API.NotFound if there is one.
+type notFound struct {
+	api *API
+}
+
+func (h notFound) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d := DataFromContext(r.Context())
+	if h.api.notFound == nil {
+		h.api.endCall(w, r, ErrNotFound(r.URL.Path), d)
+		return
+	}
+	result, err := h.api.notFound(w, r, d)
+	if err = nilIfTypedNil(err); err != nil {
+		h.api.endCall(w, r, err, d)
+		return
+	}
+	if result != nil {
+		// The result is negotiated like the body of any call
+		out, apiErr := h.api.responseCodec(r, nil)
+		if apiErr != nil {
+			h.api.endCall(w, r, apiErr, d)
+			return
+		}
+		var buf bytes.Buffer
+		if err := out.Encode(&buf, result); err != nil {
+			h.api.endCall(w, r, ErrInternal("Response from the not found handler could not be encoded as "+out.MediaType()+": "+err.Error()), d)
+			return
+		}
+		w.Header().Set("Content-Type", out.MediaType())
+		w.Header().Add("Vary", "Accept")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(buf.Bytes())
 	}
+	h.api.endCall(w, r, nil, d)
 }
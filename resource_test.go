@@ -0,0 +1,36 @@
+package sleepy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNotFound(t *testing.T) {
+	res := NewResource("/items")
+	res.Route("").Method("GET").Returns(codecItem{}).To(returns(codecItem{Name: "a"}, nil))
+
+	runCases(t, newTestAPI(t, res), []httpCase{
+		{title: "default", url: "/api/nothing", status: http.StatusNotFound, check: hasJSON("code", float64(ERR_NOT_FOUND))},
+		{title: "default in a resource", url: "/api/items/nothing", status: http.StatusNotFound, check: hasJSON("code", float64(ERR_NOT_FOUND))},
+	})
+
+	// The handler returns a result, unless the path asks for an error
+	api := newTestAPI(t, res)
+	api.NotFound(func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+		if r.URL.Path == "/api/gone" {
+			return nil, ErrTimeout("lookup")
+		}
+		return codecItem{Name: "missing"}, nil
+	})
+	runCases(t, api, []httpCase{
+		{title: "json", url: "/api/nothing", status: http.StatusNotFound,
+			check: all(hasHeader("Content-Type", "application/json"), hasHeader("Vary", "Accept"), hasJSON("name", "missing"))},
+		{title: "in a resource", url: "/api/items/nothing", status: http.StatusNotFound, check: hasJSON("name", "missing")},
+		{title: "xml", url: "/api/nothing", headers: []string{"Accept", "application/xml"}, status: http.StatusNotFound,
+			check: all(hasHeader("Content-Type", "application/xml"), hasBody("<name>missing</name>"))},
+		{title: "msgpack", url: "/api/nothing", headers: []string{"Accept", "application/msgpack"}, status: http.StatusNotFound,
+			check: hasHeader("Content-Type", "application/msgpack")},
+		{title: "not acceptable", url: "/api/nothing", headers: []string{"Accept", "text/html"}, status: http.StatusNotAcceptable},
+		{title: "error", url: "/api/gone", status: http.StatusServiceUnavailable, check: hasJSON("code", float64(ERR_TIMEOUT))},
+	})
+}
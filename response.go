@@ -0,0 +1,151 @@
+package sleepy
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// A handler can return a Response, or a pointer to one, to choose the status //
+// and headers of a successful response. The Body is written like any other   //
+// result of a handler. A zero Status is the default status of the call, see  //
+// ReturnsStatus, and a nil Body results in a response without a body.        //
+////////////////////////////////////////////////////////////////////////////////
+type Response struct {
+	Status  int
+	Headers http.Header
+	Body    interface{}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Create a 201 response for a newly created resource, with the Location      //
+// header set to the given URL. See Call.URL to build the URL of the call     //
+// that serves the new resource.                                              //
+////////////////////////////////////////////////////////////////////////////////
+func Created(location string, body interface{}) *Response {
+	return &Response{
+		Status:  http.StatusCreated,
+		Headers: http.Header{"Location": {location}},
+		Body:    body,
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Declare a response of the call with the given status and model. The model  //
+// is used like the model of Returns, which declares the 200 response. A call //
+// can declare one response per status, and the first 2xx status declared is  //
+// written when the handler doesn't choose one with a Response.               //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) ReturnsStatus(status int, m interface{}) *Call {
+	out := modelOut{status: status, model: m}
+	if isStructModel(m) {
+		scrubPlanOf(reflect.TypeOf(m))
+	}
+	for i := range c.model.bodyOut {
+		if c.model.bodyOut[i].status == status {
+			c.model.bodyOut[i] = out
+			return c
+		}
+	}
+	c.model.bodyOut = append(c.model.bodyOut, out)
+	return c
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Declare that the call responds with 204 No Content. Unless another 2xx     //
+// status was declared first, a handler of the call can return a nil result   //
+// to send it.                                                                //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) ReturnsNoContent() *Call {
+	return c.ReturnsStatus(http.StatusNoContent, nil)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Build the URL of the call from its path template. The values of the path   //
+// variables are given as name/value pairs, e.g. c.URL("uid", "42"). The call //
+// must be registered with the API first.                                     //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) URL(pairs ...string) (*url.URL, error) {
+	if c.route == nil {
+		return nil, errors.New("sleepy: call " + c.name() + " is not registered")
+	}
+	return c.route.URLPath(pairs...)
+}
+
+// set copies a Response returned by a handler into resp, keeping the default
+// status if it has none.
+func (resp *Response) set(res *Response) {
+	if res == nil {
+		resp.Body = nil
+		return
+	}
+	if res.Status != 0 {
+		resp.Status = res.Status
+	}
+	resp.Headers = res.Headers.Clone()
+	if resp.Headers == nil {
+		resp.Headers = make(http.Header)
+	}
+	resp.Body = res.Body
+}
+
+// defaultStatus is the status of a successful response when the handler does
+// not choose one.
+func (c *Call) defaultStatus() int {
+	for _, out := range c.model.bodyOut {
+		if out.status >= 200 && out.status < 300 {
+			return out.status
+		}
+	}
+	return http.StatusOK
+}
+
+// statusWriter remembers the status of the response, so that it can be logged
+// when the call ends.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher if the underlying ResponseWriter does.
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// findStatusWriter finds the statusWriter of the API under the writers of any
+// net/http middleware, as long as they can be unwrapped like statusWriter.
+func findStatusWriter(w http.ResponseWriter) *statusWriter {
+	for {
+		switch ww := w.(type) {
+		case *statusWriter:
+			return ww
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = ww.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package sleepy
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// The fields of a struct type that are removed from responses. strip holds   //
+// the writeonly and hidden fields, and walk the fields that can hold other   //
+// structs with such fields, through pointers, slices, maps or interfaces.    //
+// Plans are built once per type and shared by every call, so that any shape  //
+// the handler returns can be scrubbed, not only the declared models.         //
+////////////////////////////////////////////////////////////////////////////////
+type scrubPlan struct {
+	strip []int
+	walk  []int
+}
+
+// The scrub plans of every struct type seen so far. A nil plan means that the
+// type has nothing to scrub.
+var scrubPlans sync.Map
+
+// scrubPlanOf returns the scrub plan of a struct type, building and caching it
+// on first use.
+func scrubPlanOf(t reflect.Type) *scrubPlan {
+	if plan, ok := scrubPlans.Load(t); ok {
+		return plan.(*scrubPlan)
+	}
+	seen := make(map[reflect.Type]*scrubPlan)
+	plan := buildScrubPlan(t, seen)
+	for st, p := range seen {
+		scrubPlans.LoadOrStore(st, p)
+	}
+	return plan
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Build the scrub plan of a struct type. Like buildStructRules, plans are    //
+// kept in seen while they are built, which stops the recursion on models     //
+// that refer to themselves. Returns nil if nothing in the type is scrubbed.  //
+////////////////////////////////////////////////////////////////////////////////
+func buildScrubPlan(t reflect.Type, seen map[reflect.Type]*scrubPlan) *scrubPlan {
+	if plan, ok := seen[t]; ok {
+		return plan
+	}
+	if plan, ok := scrubPlans.Load(t); ok {
+		return plan.(*scrubPlan)
+	}
+	plan := &scrubPlan{}
+	seen[t] = plan
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if _, ok := jsonFieldName(field); !ok {
+			continue
+		}
+		if hasSleepyTag(field, sleepyWriteOnly) || hasSleepyTag(field, sleepyHidden) {
+			plan.strip = append(plan.strip, i)
+		} else if holdsScrubbed(field.Type, seen) {
+			plan.walk = append(plan.walk, i)
+		}
+	}
+	if len(plan.strip) == 0 && len(plan.walk) == 0 {
+		seen[t] = nil
+		return nil
+	}
+	return plan
+}
+
+// holdsScrubbed reports if values of type t can contain fields to scrub.
+// Interfaces can hold anything, so they are always walked.
+func holdsScrubbed(t reflect.Type, seen map[reflect.Type]*scrubPlan) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return holdsScrubbed(t.Elem(), seen)
+	case reflect.Interface:
+		return true
+	case reflect.Struct:
+		if seen == nil {
+			// Not building a plan, so it comes from the cache.
+			return scrubPlanOf(t) != nil
+		}
+		return buildScrubPlan(t, seen) != nil
+	}
+	return false
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Remove the writeonly and hidden fields from a response body of any shape,  //
+// e.g. a model, a slice or map of models, or a wrapper that holds them. The  //
+// body itself is never changed, since the handler may share it, e.g. from a  //
+// cache. The parts of it that hold scrubbed fields are copied instead, and   //
+// the scrubbed copy is returned. A body that refers to itself can't be       //
+// encoded, so it is returned as an error instead of being followed forever.  //
+////////////////////////////////////////////////////////////////////////////////
+func scrub(body interface{}) (interface{}, error) {
+	if body == nil {
+		return nil, nil
+	}
+	sw := &scrubWalk{path: make(map[scrubRef]bool)}
+	v, changed, err := sw.value(reflect.ValueOf(body))
+	if err != nil || !changed {
+		return body, err
+	}
+	return v.Interface(), nil
+}
+
+// errScrubCycle is returned by scrub for bodies that contain themselves.
+var errScrubCycle = errors.New("the response body refers to itself")
+
+// scrubRef identifies a pointer, map or slice on the path being scrubbed.
+// Slices also need their type and length, since a slice and its first element
+// share the same address.
+type scrubRef struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// scrubWalk follows a response body and keeps the pointers, maps and slices
+// that lead to the current value in path, so that cycles are noticed.
+type scrubWalk struct {
+	path map[scrubRef]bool
+}
+
+// enter adds a pointer, map or slice to the path, or fails if it is on the
+// path already. leave must be called with the ref when it is done.
+func (sw *scrubWalk) enter(v reflect.Value) (scrubRef, error) {
+	ref := scrubRef{ptr: v.Pointer(), typ: v.Type()}
+	if v.Kind() == reflect.Slice {
+		ref.len = v.Len()
+	}
+	if sw.path[ref] {
+		return ref, errScrubCycle
+	}
+	sw.path[ref] = true
+	return ref, nil
+}
+
+func (sw *scrubWalk) leave(ref scrubRef) {
+	delete(sw.path, ref)
+}
+
+// value returns a scrubbed copy of v, and true, or v itself and false if there
+// was nothing to scrub.
+func (sw *scrubWalk) value(v reflect.Value) (reflect.Value, bool, error) {
+	t := v.Type()
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v, false, nil
+		}
+		ref, err := sw.enter(v)
+		if err != nil {
+			return v, false, err
+		}
+		defer sw.leave(ref)
+		elem, changed, err := sw.value(v.Elem())
+		if err != nil || !changed {
+			return v, false, err
+		}
+		p := reflect.New(t.Elem())
+		p.Elem().Set(elem)
+		return p, true, nil
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v, false, nil
+		}
+		elem, changed, err := sw.value(v.Elem())
+		if err != nil || !changed {
+			return v, false, err
+		}
+		i := reflect.New(t).Elem()
+		i.Set(elem)
+		return i, true, nil
+
+	case reflect.Struct:
+		plan := scrubPlanOf(t)
+		if plan == nil {
+			return v, false, nil
+		}
+		c := reflect.New(t).Elem()
+		c.Set(v)
+		changed := false
+		for _, i := range plan.strip {
+			if f := c.Field(i); f.CanSet() && !f.IsZero() {
+				f.Set(reflect.Zero(f.Type()))
+				changed = true
+			}
+		}
+		for _, i := range plan.walk {
+			f := c.Field(i)
+			if !f.CanSet() {
+				continue
+			}
+			fv, ok, err := sw.value(f)
+			if err != nil {
+				return v, false, err
+			}
+			if ok {
+				f.Set(fv)
+				changed = true
+			}
+		}
+		return c, changed, nil
+
+	case reflect.Slice, reflect.Array:
+		if (v.Kind() == reflect.Slice && v.IsNil()) || !holdsScrubbed(t.Elem(), nil) {
+			return v, false, nil
+		}
+		if v.Kind() == reflect.Slice {
+			ref, err := sw.enter(v)
+			if err != nil {
+				return v, false, err
+			}
+			defer sw.leave(ref)
+		}
+		var c reflect.Value
+		for i := 0; i < v.Len(); i++ {
+			ev, ok, err := sw.value(v.Index(i))
+			if err != nil {
+				return v, false, err
+			}
+			if !ok {
+				continue
+			}
+			if !c.IsValid() {
+				c = copyList(v)
+			}
+			c.Index(i).Set(ev)
+		}
+		return c, c.IsValid(), nil
+
+	case reflect.Map:
+		if v.IsNil() || !holdsScrubbed(t.Elem(), nil) {
+			return v, false, nil
+		}
+		ref, err := sw.enter(v)
+		if err != nil {
+			return v, false, err
+		}
+		defer sw.leave(ref)
+		var c reflect.Value
+		iter := v.MapRange()
+		for iter.Next() {
+			ev, ok, err := sw.value(iter.Value())
+			if err != nil {
+				return v, false, err
+			}
+			if !ok {
+				continue
+			}
+			if !c.IsValid() {
+				c = reflect.MakeMapWithSize(t, v.Len())
+				for _, key := range v.MapKeys() {
+					c.SetMapIndex(key, v.MapIndex(key))
+				}
+			}
+			c.SetMapIndex(iter.Key(), ev)
+		}
+		return c, c.IsValid(), nil
+	}
+	return v, false, nil
+}
+
+// copyList copies a slice or an array into a new settable value.
+func copyList(v reflect.Value) reflect.Value {
+	if v.Kind() == reflect.Array {
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		return c
+	}
+	c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	reflect.Copy(c, v)
+	return c
+}
@@ -0,0 +1,56 @@
+package sleepy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type scrubAccount struct {
+	Name     string
+	Password string        `sleepy:"writeonly"`
+	Internal string        `sleepy:"hidden"`
+	Friends  []interface{} `json:",omitempty"`
+	Next     *scrubAccount `json:",omitempty"`
+}
+
+func TestScrub(t *testing.T) {
+	shared := &scrubAccount{Name: "a", Password: "secret", Internal: "x"}
+	looped := &scrubAccount{Name: "loop", Password: "secret"}
+	looped.Next = looped
+	list := []interface{}{nil}
+	list[0] = list
+
+	// The handler returns the body named by the query
+	bodies := map[string]interface{}{
+		"pointer":       shared,
+		"slice":         []scrubAccount{*shared},
+		"map":           map[string]*scrubAccount{"a": shared},
+		"interface":     scrubAccount{Name: "b", Friends: []interface{}{shared}},
+		"pointer-cycle": looped,
+		"slice-cycle":   scrubAccount{Friends: list},
+	}
+	res := NewResource("/accounts")
+	res.Route("").Method("GET").Returns(scrubAccount{}).
+		To(func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+			return bodies[r.URL.Query().Get("body")], nil
+		})
+
+	scrubbed := func(t *testing.T, w *httptest.ResponseRecorder) {
+		if body := w.Body.String(); strings.Contains(body, "secret") || strings.Contains(body, `"Internal":"x"`) {
+			t.Errorf("scrubbed fields in the response: %s", body)
+		}
+	}
+	runCases(t, newTestAPI(t, res), []httpCase{
+		{title: "pointer", url: "/api/accounts?body=pointer", status: http.StatusOK, check: scrubbed},
+		{title: "slice", url: "/api/accounts?body=slice", status: http.StatusOK, check: scrubbed},
+		{title: "map", url: "/api/accounts?body=map", status: http.StatusOK, check: scrubbed},
+		{title: "interface", url: "/api/accounts?body=interface", status: http.StatusOK, check: scrubbed},
+		{title: "pointer cycle", url: "/api/accounts?body=pointer-cycle", status: http.StatusInternalServerError},
+		{title: "slice cycle", url: "/api/accounts?body=slice-cycle", status: http.StatusInternalServerError},
+	})
+	if shared.Password != "secret" || shared.Internal != "x" {
+		t.Errorf("the value of the handler was changed: %+v", shared)
+	}
+}
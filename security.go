@@ -0,0 +1,419 @@
+package sleepy
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// The identity that a security scheme verified for a request. It is stored   //
+// in the CallData before the filters of the call run, see                    //
+// CallData.Principal. Scheme is the name of the scheme, Subject the user or  //
+// client that was verified, and Claims holds the claims of a JWT.            //
+////////////////////////////////////////////////////////////////////////////////
+type Principal struct {
+	Scheme  string
+	Subject string
+	Claims  map[string]interface{}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// A Verifier authenticates requests for a security scheme, see               //
+// API.SecurityScheme. Verify returns ErrNoCredentials if the request carries //
+// no credentials for the scheme at all, and any other error if it carries    //
+// credentials that are invalid. Challenge is sent in the WWW-Authenticate    //
+// header of a 401, and Describe documents the scheme in the OpenAPI          //
+// document.                                                                  //
+//                                                                            //
+// NewJWTVerifier, NewAPIKeyVerifier and NewBasicVerifier create the built in //
+// verifiers.                                                                 //
+////////////////////////////////////////////////////////////////////////////////
+type Verifier interface {
+	Verify(r *http.Request) (*Principal, error)
+	Challenge() string
+	Describe() SecuritySchemeDoc
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// The OpenAPI security scheme object of a Verifier. Type is "http" with a    //
+// Scheme, e.g. "bearer" or "basic", or "apiKey" with a Name and where it is  //
+// sent, In, which is "header", "query" or "cookie".                          //
+////////////////////////////////////////////////////////////////////////////////
+type SecuritySchemeDoc struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// Returned by a Verifier when the request has no credentials for its scheme.
+var ErrNoCredentials = errors.New("no credentials were sent")
+
+////////////////////////////////////////////////////////////////////////////////
+// Add a security scheme to the API. Calls and resources refer to it by its   //
+// name, see Call.Security, so it must be added before they are registered.   //
+////////////////////////////////////////////////////////////////////////////////
+func (api *API) SecurityScheme(name string, v Verifier) {
+	if api.schemes == nil {
+		api.schemes = make(map[string]Verifier)
+	}
+	api.schemes[name] = v
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Require every call of the resource to be authenticated by one of the named //
+// security schemes, unless the call sets its own, see Call.Security.         //
+////////////////////////////////////////////////////////////////////////////////
+func (r *Resource) Security(schemes ...string) {
+	r.security = append([]string{}, schemes...)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Require the call to be authenticated by one of the named security schemes, //
+// which are tried in order. The first one that verifies the request stores   //
+// its Principal in the CallData. If none does, the call ends with a 401 and  //
+// a WWW-Authenticate challenge for every scheme. Calling Security without    //
+// names makes the call public, even if its resource is not.                  //
+////////////////////////////////////////////////////////////////////////////////
+func (c *Call) Security(schemes ...string) *Call {
+	c.security = append([]string{}, schemes...)
+	return c
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Get the Principal that a security scheme verified for the call. Returns    //
+// nil for public calls.                                                      //
+////////////////////////////////////////////////////////////////////////////////
+func (d CallData) Principal() *Principal {
+	return principalKey.Value(d)
+}
+
+// securitySchemes returns the names of the schemes that protect the call.
+func (c *Call) securitySchemes() []string {
+	if c.security != nil {
+		return c.security
+	}
+	return c.resource.security
+}
+
+// authenticate verifies the request with the schemes of the call, and stores
+// the Principal in the CallData.
+func (c *Call) authenticate(w http.ResponseWriter, r *http.Request, d CallData) error {
+	schemes := c.securitySchemes()
+	if len(schemes) == 0 {
+		return nil
+	}
+	api := c.resource.api
+	var failure error
+	for _, name := range schemes {
+		p, err := api.schemes[name].Verify(r)
+		if err == nil && p != nil {
+			if p.Scheme == "" {
+				p.Scheme = name
+			}
+			principalKey.Set(d, p)
+			return nil
+		}
+		if err != nil && !errors.Is(err, ErrNoCredentials) && failure == nil {
+			failure = err
+		}
+	}
+
+	for _, name := range schemes {
+		w.Header().Add("WWW-Authenticate", api.schemes[name].Challenge())
+	}
+	var httpErr HTTPError
+	if errors.As(failure, &httpErr) {
+		return failure
+	}
+	if failure != nil {
+		return ErrUnauthorized("The credentials are invalid: " + failure.Error() + ".")
+	}
+	return ErrUnauthorized("The request has no credentials.")
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// The settings of a JWT verifier. Tokens are verified with a local key set:  //
+//                                                                            //
+// - Keys:     The keys by key ID, the kid of the token header. HS256 keys    //
+//             are []byte secrets, RS256 keys are *rsa.PublicKey. Tokens      //
+//             without a kid use the key under "", or the only key there is.  //
+//             The algorithm of a token must match the type of its key.       //
+// - Issuer:   If set, the iss claim must be equal to it.                     //
+// - Audience: If set, the aud claim must be or contain it.                   //
+// - Leeway:   The clock skew allowed when checking exp and nbf.              //
+// - Realm:    The realm of the WWW-Authenticate challenge, if any.           //
+////////////////////////////////////////////////////////////////////////////////
+type JWTConfig struct {
+	Keys     map[string]interface{}
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+	Realm    string
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Create a Verifier for JWTs sent as bearer tokens in the Authorization      //
+// header. The Subject of the Principal is the sub claim, and all of the      //
+// claims of the token are kept in Claims. Tokens whose exp or nbf claims     //
+// aren't numbers are rejected. Register fails if the verifier has no keys,   //
+// or an empty HS256 secret, which would let anyone sign a valid token.       //
+////////////////////////////////////////////////////////////////////////////////
+func NewJWTVerifier(cfg JWTConfig) Verifier {
+	return &jwtVerifier{cfg: cfg}
+}
+
+type jwtVerifier struct {
+	cfg JWTConfig
+}
+
+func (v *jwtVerifier) Verify(r *http.Request) (*Principal, error) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return nil, ErrNoCredentials
+	}
+	parts := strings.Split(strings.TrimSpace(auth[7:]), ".")
+	if len(parts) != 3 {
+		return nil, errors.New("the token is not a JWT")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, errors.New("the token header is invalid")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("the token signature is invalid")
+	}
+	key, ok := v.key(header.Kid)
+	if !ok {
+		return nil, errors.New("the token key is unknown")
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch key := key.(type) {
+	case []byte:
+		// An empty secret would let anyone sign tokens, see checkConfig.
+		if len(key) == 0 {
+			return nil, errors.New("the token key is unknown")
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(signed)
+		if header.Alg != "HS256" || !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil, errors.New("the token signature is invalid")
+		}
+	case *rsa.PublicKey:
+		hash := sha256.Sum256(signed)
+		if header.Alg != "RS256" || key == nil || rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig) != nil {
+			return nil, errors.New("the token signature is invalid")
+		}
+	default:
+		return nil, errors.New("the token key has an unsupported type")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, errors.New("the token claims are invalid")
+	}
+	now := time.Now()
+	exp, hasExp, err := numericDate(claims, "exp")
+	if err != nil {
+		return nil, err
+	}
+	if hasExp && now.After(exp.Add(v.cfg.Leeway)) {
+		return nil, errors.New("the token has expired")
+	}
+	nbf, hasNbf, err := numericDate(claims, "nbf")
+	if err != nil {
+		return nil, err
+	}
+	if hasNbf && now.Before(nbf.Add(-v.cfg.Leeway)) {
+		return nil, errors.New("the token is not valid yet")
+	}
+	if v.cfg.Issuer != "" && claims["iss"] != v.cfg.Issuer {
+		return nil, errors.New("the token issuer is not accepted")
+	}
+	if v.cfg.Audience != "" && !hasAudience(claims["aud"], v.cfg.Audience) {
+		return nil, errors.New("the token audience is not accepted")
+	}
+	sub, _ := claims["sub"].(string)
+	return &Principal{Subject: sub, Claims: claims}, nil
+}
+
+// key finds the key of a token by its kid.
+func (v *jwtVerifier) key(kid string) (interface{}, bool) {
+	if key, ok := v.cfg.Keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(v.cfg.Keys) == 1 {
+		for _, key := range v.cfg.Keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// checkConfig reports keys that can't verify tokens safely, most of all empty
+// HS256 secrets, which would let anyone sign a valid token.
+func (v *jwtVerifier) checkConfig() []string {
+	if len(v.cfg.Keys) == 0 {
+		return []string{"the JWT verifier has no keys"}
+	}
+	var problems []string
+	for kid, key := range v.cfg.Keys {
+		switch key := key.(type) {
+		case []byte:
+			if len(key) == 0 {
+				problems = append(problems, "the HS256 key '"+kid+"' of the JWT verifier is empty")
+			}
+		case *rsa.PublicKey:
+			if key == nil {
+				problems = append(problems, "the RS256 key '"+kid+"' of the JWT verifier is nil")
+			}
+		default:
+			problems = append(problems, "the key '"+kid+"' of the JWT verifier is neither a []byte nor an *rsa.PublicKey")
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+func (v *jwtVerifier) Challenge() string {
+	if v.cfg.Realm != "" {
+		return `Bearer realm="` + v.cfg.Realm + `"`
+	}
+	return "Bearer"
+}
+
+func (v *jwtVerifier) Describe() SecuritySchemeDoc {
+	return SecuritySchemeDoc{Type: "http", Scheme: "bearer", BearerFormat: "JWT"}
+}
+
+// decodeJWTPart decodes a base64url encoded JSON part of a JWT into v.
+func decodeJWTPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// numericDate reads a NumericDate claim of a JWT, and whether it was there.
+// A claim that is there but isn't a number makes the token invalid, so that
+// e.g. an exp sent as a string can't make a token valid forever.
+func numericDate(claims map[string]interface{}, name string) (time.Time, bool, error) {
+	claim, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	seconds, ok := claim.(float64)
+	if !ok {
+		return time.Time{}, false, errors.New("the token " + name + " claim is not a number")
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), true, nil
+}
+
+// hasAudience checks the aud claim, which is a string or a list of strings.
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Create a Verifier for API keys sent in a header, a query parameter or a    //
+// cookie, as told by in, under the given name. lookup returns the subject    //
+// that owns the key, and false if the key is unknown.                        //
+////////////////////////////////////////////////////////////////////////////////
+func NewAPIKeyVerifier(in, name string, lookup func(key string) (string, bool)) Verifier {
+	return &apiKeyVerifier{in: in, name: name, lookup: lookup}
+}
+
+type apiKeyVerifier struct {
+	in     string
+	name   string
+	lookup func(key string) (string, bool)
+}
+
+func (v *apiKeyVerifier) Verify(r *http.Request) (*Principal, error) {
+	var key string
+	switch v.in {
+	case "header":
+		key = r.Header.Get(v.name)
+	case "query":
+		key = r.URL.Query().Get(v.name)
+	case "cookie":
+		if c, err := r.Cookie(v.name); err == nil {
+			key = c.Value
+		}
+	}
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	subject, ok := v.lookup(key)
+	if !ok {
+		return nil, errors.New("the API key is unknown")
+	}
+	return &Principal{Subject: subject}, nil
+}
+
+func (v *apiKeyVerifier) Challenge() string {
+	return `APIKey in="` + v.in + `", name="` + v.name + `"`
+}
+
+func (v *apiKeyVerifier) Describe() SecuritySchemeDoc {
+	return SecuritySchemeDoc{Type: "apiKey", In: v.in, Name: v.name}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Create a Verifier for HTTP Basic authentication. check reports if the      //
+// password of the user is correct, and the user becomes the Subject.         //
+////////////////////////////////////////////////////////////////////////////////
+func NewBasicVerifier(realm string, check func(user, password string) bool) Verifier {
+	return &basicVerifier{realm: realm, check: check}
+}
+
+type basicVerifier struct {
+	realm string
+	check func(user, password string) bool
+}
+
+func (v *basicVerifier) Verify(r *http.Request) (*Principal, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	if !v.check(user, password) {
+		return nil, errors.New("the user name or password is wrong")
+	}
+	return &Principal{Subject: user}, nil
+}
+
+func (v *basicVerifier) Challenge() string {
+	return `Basic realm="` + v.realm + `", charset="UTF-8"`
+}
+
+func (v *basicVerifier) Describe() SecuritySchemeDoc {
+	return SecuritySchemeDoc{Type: "http", Scheme: "basic"}
+}
@@ -0,0 +1,233 @@
+package sleepy
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("a secret of the test")
+
+// signJWT builds a token with the header and claims, signed with key, which
+// is a []byte for HS256 or an *rsa.PrivateKey for RS256.
+func signJWT(t *testing.T, header, claims map[string]interface{}, key interface{}) string {
+	t.Helper()
+	part := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := part(header) + "." + part(claims)
+	var sig []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		hash := sha256.Sum256([]byte(signed))
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// meResource serves GET /me, which returns the principal, protected by the
+// named schemes, and GET /me/public, which isn't protected.
+func meResource(schemes ...string) *Resource {
+	res := NewResource("/me")
+	res.Security(schemes...)
+	res.Route("").Method("GET").Returns(map[string]string{}).
+		To(func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+			p := d.Principal()
+			return map[string]string{"scheme": p.Scheme, "subject": p.Subject}, nil
+		})
+	res.Route("/public").Method("GET").Security().Returns(map[string]string{}).
+		To(func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+			return map[string]string{"public": "yes"}, nil
+		})
+	return res
+}
+
+// isPrincipal checks the principal returned by GET /me.
+func isPrincipal(scheme, subject string) responseCheck {
+	return all(hasJSON("scheme", scheme), hasJSON("subject", subject))
+}
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := New("/api", false)
+	api.SecurityScheme("bearer", NewJWTVerifier(JWTConfig{
+		Keys:     map[string]interface{}{"hs": testSecret, "rs": &rsaKey.PublicKey},
+		Issuer:   "auth",
+		Audience: "api",
+		Realm:    "test",
+	}))
+	register(t, api, meResource("bearer"))
+
+	now := time.Now().Unix()
+	valid := func(extra ...interface{}) map[string]interface{} {
+		claims := map[string]interface{}{"sub": "ann", "iss": "auth", "aud": "api", "exp": now + 60}
+		for i := 0; i+1 < len(extra); i += 2 {
+			if extra[i+1] == nil {
+				delete(claims, extra[i].(string))
+			} else {
+				claims[extra[i].(string)] = extra[i+1]
+			}
+		}
+		return claims
+	}
+	hs := map[string]interface{}{"alg": "HS256", "kid": "hs"}
+	rs := map[string]interface{}{"alg": "RS256", "kid": "rs"}
+
+	accepted := func(title, token string) httpCase {
+		return httpCase{title: title, url: "/api/me", headers: []string{"Authorization", "Bearer " + token}, status: http.StatusOK, check: isPrincipal("bearer", "ann")}
+	}
+	rejected := func(title, auth string) httpCase {
+		return httpCase{title: title, url: "/api/me", headers: []string{"Authorization", auth}, status: http.StatusUnauthorized, check: hasHeader("WWW-Authenticate", `Bearer realm="test"`)}
+	}
+	runCases(t, api, []httpCase{
+		accepted("HS256", signJWT(t, hs, valid(), testSecret)),
+		accepted("RS256", signJWT(t, rs, valid(), rsaKey)),
+		accepted("audience list", signJWT(t, hs, valid("aud", []string{"web", "api"}), testSecret)),
+		accepted("without exp", signJWT(t, hs, valid("exp", nil), testSecret)),
+		rejected("no credentials", ""),
+		rejected("other scheme", "Basic YTpi"),
+		rejected("not a JWT", "Bearer abc"),
+		rejected("bad signature", "Bearer "+signJWT(t, hs, valid(), []byte("another secret"))),
+		rejected("bad RSA signature", "Bearer "+signJWT(t, rs, valid(), otherKey)),
+		rejected("wrong alg for HMAC key", "Bearer "+signJWT(t, map[string]interface{}{"alg": "HS512", "kid": "hs"}, valid(), testSecret)),
+		rejected("HMAC with the RSA key", "Bearer "+signJWT(t, map[string]interface{}{"alg": "HS256", "kid": "rs"}, valid(), testSecret)),
+		rejected("alg none", "Bearer "+signJWT(t, map[string]interface{}{"alg": "none", "kid": "hs"}, valid(), nil)),
+		rejected("unknown kid", "Bearer "+signJWT(t, map[string]interface{}{"alg": "HS256", "kid": "x"}, valid(), testSecret)),
+		rejected("expired", "Bearer "+signJWT(t, hs, valid("exp", now-60), testSecret)),
+		rejected("exp not a number", "Bearer "+signJWT(t, hs, valid("exp", "never"), testSecret)),
+		rejected("not valid yet", "Bearer "+signJWT(t, hs, valid("nbf", now+60), testSecret)),
+		rejected("nbf not a number", "Bearer "+signJWT(t, hs, valid("nbf", "soon"), testSecret)),
+		rejected("wrong issuer", "Bearer "+signJWT(t, hs, valid("iss", "evil"), testSecret)),
+		rejected("wrong audience", "Bearer "+signJWT(t, hs, valid("aud", "web"), testSecret)),
+		{title: "public call", url: "/api/me/public", status: http.StatusOK, check: hasJSON("public", "yes")},
+	})
+}
+
+func TestJWTVerifierConfig(t *testing.T) {
+	tests := []struct {
+		title string
+		keys  map[string]interface{}
+		ok    bool
+	}{
+		{"secret", map[string]interface{}{"": testSecret}, true},
+		{"no keys", nil, false},
+		{"empty secret", map[string]interface{}{"": []byte("")}, false},
+		{"nil RSA key", map[string]interface{}{"": (*rsa.PublicKey)(nil)}, false},
+		{"unsupported key", map[string]interface{}{"": "a string"}, false},
+	}
+	for _, test := range tests {
+		api := New("/api", false)
+		api.SecurityScheme("bearer", NewJWTVerifier(JWTConfig{Keys: test.keys}))
+		res := NewResource("/me")
+		res.Security("bearer")
+		res.Route("").Method("GET").ReturnsNoContent().
+			To(func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+				return nil, nil
+			})
+		err := api.Register(res)
+		var regErr *RegistrationError
+		if test.ok != (err == nil) || (err != nil && !errors.As(err, &regErr)) {
+			t.Errorf("%s: Register returned %v", test.title, err)
+		}
+	}
+
+	// Even if it isn't registered, an empty secret never verifies a token
+	empty := NewJWTVerifier(JWTConfig{Keys: map[string]interface{}{"": []byte{}}})
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+signJWT(t, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "eve"}, []byte{}))
+	if p, err := empty.Verify(r); err == nil {
+		t.Errorf("a token signed with an empty secret was accepted: %+v", p)
+	}
+}
+
+func TestAPIKeyVerifier(t *testing.T) {
+	lookup := func(key string) (string, bool) {
+		return "svc", key == "k1"
+	}
+	api := New("/api", false)
+	api.SecurityScheme("header", NewAPIKeyVerifier("header", "X-API-Key", lookup))
+	api.SecurityScheme("query", NewAPIKeyVerifier("query", "api_key", lookup))
+	api.SecurityScheme("cookie", NewAPIKeyVerifier("cookie", "key", lookup))
+	register(t, api, meResource("header", "query", "cookie"))
+
+	// Every scheme of the call sends its challenge
+	challenges := func(t *testing.T, w *httptest.ResponseRecorder) {
+		if got := w.Header().Values("WWW-Authenticate"); len(got) != 3 {
+			t.Errorf("got challenges %q, want one per scheme", got)
+		}
+	}
+	runCases(t, api, []httpCase{
+		{title: "header", url: "/api/me", headers: []string{"X-API-Key", "k1"}, status: http.StatusOK, check: isPrincipal("header", "svc")},
+		{title: "query", url: "/api/me?api_key=k1", status: http.StatusOK, check: isPrincipal("query", "svc")},
+		{title: "cookie", url: "/api/me", headers: []string{"Cookie", "key=k1"}, status: http.StatusOK, check: isPrincipal("cookie", "svc")},
+		{title: "unknown key", url: "/api/me", headers: []string{"X-API-Key", "k2"}, status: http.StatusUnauthorized, check: challenges},
+		{title: "falls through to a valid key", url: "/api/me?api_key=k1", headers: []string{"X-API-Key", "k2"}, status: http.StatusOK, check: isPrincipal("query", "svc")},
+		{title: "no key", url: "/api/me", status: http.StatusUnauthorized, check: challenges},
+	})
+}
+
+func TestBasicVerifier(t *testing.T) {
+	api := New("/api", false)
+	api.SecurityScheme("basic", NewBasicVerifier("test", func(user, password string) bool {
+		return user == "ann" && password == "pw"
+	}))
+	register(t, api, meResource("basic"))
+
+	basic := func(title, auth string, status int) httpCase {
+		c := httpCase{title: title, url: "/api/me", headers: []string{"Authorization", auth}, status: status, check: isPrincipal("basic", "ann")}
+		if status != http.StatusOK {
+			c.check = hasHeader("WWW-Authenticate", `Basic realm="test", charset="UTF-8"`)
+		}
+		return c
+	}
+	credentials := func(user, password string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	}
+	runCases(t, api, []httpCase{
+		basic("valid", credentials("ann", "pw"), http.StatusOK),
+		basic("wrong password", credentials("ann", "nope"), http.StatusUnauthorized),
+		basic("unknown user", credentials("bob", "pw"), http.StatusUnauthorized),
+		basic("malformed", "Basic !!!", http.StatusUnauthorized),
+		basic("no credentials", "", http.StatusUnauthorized),
+	})
+}
+
+func TestUnknownScheme(t *testing.T) {
+	api := New("/api", false)
+	res := NewResource("/me")
+	res.Route("").Method("GET").Security("missing").ReturnsNoContent().
+		To(func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+			return nil, nil
+		})
+	if err := api.Register(res); err == nil || !strings.Contains(err.Error(), "unknown security scheme 'missing'") {
+		t.Errorf("Register returned %v, want an unknown scheme error", err)
+	}
+}
@@ -0,0 +1,174 @@
+package sleepy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// newTestAPI registers the resources with a new API under /api, failing the
+// test if they can't be registered.
+func newTestAPI(t *testing.T, resources ...*Resource) *API {
+	t.Helper()
+	return register(t, New("/api", false), resources...)
+}
+
+// register registers the resources with an API that was set up already, e.g.
+// with its security schemes.
+func register(t *testing.T, api *API, resources ...*Resource) *API {
+	t.Helper()
+	for _, res := range resources {
+		if err := api.Register(res); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+	}
+	return api
+}
+
+// returns is a handler that always returns v and err.
+func returns(v interface{}, err error) Handler {
+	return func(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+		return v, err
+	}
+}
+
+// echo is a handler that returns the body it read.
+func echo(w http.ResponseWriter, r *http.Request, d CallData) (interface{}, error) {
+	return d.Body(), nil
+}
+
+// A request to a test API and the status it must get. The method defaults to
+// GET, and headers are given as name, value pairs. If check is set, it looks
+// at the rest of the response.
+type httpCase struct {
+	title   string
+	method  string
+	url     string
+	body    string
+	headers []string
+	status  int
+	check   responseCheck
+}
+
+// A check of the response to an httpCase.
+type responseCheck func(t *testing.T, w *httptest.ResponseRecorder)
+
+// runCases sends the request of every case to the API, each in a subtest.
+func runCases(t *testing.T, api http.Handler, cases []httpCase) {
+	t.Helper()
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			method := c.method
+			if method == "" {
+				method = "GET"
+			}
+			w := do(api, method, c.url, c.body, c.headers...)
+			if w.Code != c.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, c.status, w.Body)
+			}
+			if c.check != nil {
+				c.check(t, w)
+			}
+		})
+	}
+}
+
+// do sends a request to the API and returns the response. Headers are given
+// as name, value pairs.
+func do(api http.Handler, method, url, body string, headers ...string) *httptest.ResponseRecorder {
+	var rd io.Reader
+	if body != "" {
+		rd = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, url, rd)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	return w
+}
+
+// decodeJSON decodes the body of a response into a map.
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var m map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+	return m
+}
+
+// hasJSON checks a top level field of a JSON response. Numbers are float64.
+func hasJSON(field string, want interface{}) responseCheck {
+	return func(t *testing.T, w *httptest.ResponseRecorder) {
+		t.Helper()
+		if got := decodeJSON(t, w)[field]; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %s %v, want %v", field, got, want)
+		}
+	}
+}
+
+// hasHeader checks a header of the response.
+func hasHeader(name, want string) responseCheck {
+	return func(t *testing.T, w *httptest.ResponseRecorder) {
+		t.Helper()
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("got %s %q, want %q", name, got, want)
+		}
+	}
+}
+
+// hasBody checks that the body of the response contains each of the parts.
+func hasBody(parts ...string) responseCheck {
+	return func(t *testing.T, w *httptest.ResponseRecorder) {
+		t.Helper()
+		for _, part := range parts {
+			if !strings.Contains(w.Body.String(), part) {
+				t.Errorf("got body %s, want %s in it", w.Body, part)
+			}
+		}
+	}
+}
+
+// hasFieldErrors checks the fields of a validation error, given as
+// field:rule in any order.
+func hasFieldErrors(want ...string) responseCheck {
+	return func(t *testing.T, w *httptest.ResponseRecorder) {
+		t.Helper()
+		var e Error
+		if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+			t.Fatalf("decoding %q: %v", w.Body, err)
+		}
+		got := []string{}
+		for _, f := range e.Fields {
+			got = append(got, f.Field+":"+f.Rule)
+		}
+		sort.Strings(got)
+		sort.Strings(want)
+		if want == nil {
+			want = []string{}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got errors %v, want %v", got, want)
+		}
+	}
+}
+
+// all runs every one of the checks.
+func all(checks ...responseCheck) responseCheck {
+	return func(t *testing.T, w *httptest.ResponseRecorder) {
+		t.Helper()
+		for _, check := range checks {
+			check(t, w)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package sleepy
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// Sleepy field tags that constrain the value of a field in the request body. //
+// They are written in the sleepy tag next to required and readonly, e.g.     //
+// `sleepy:"required,minLen=3,maxLen=64"`.                                    //
+//                                                                            //
+// - min=N, max=N:        Bounds for the value of a number field.             //
+// - minLen=N, maxLen=N:  Bounds for the length of a string, slice or map.    //
+// - enum=a|b|c:          The value must be one of the listed values.         //
+// - email, url, uuid:    The string must be in the given format.             //
+// - pattern=EXPR:        The string must match the regular expression. The   //
+//                        expression takes the rest of the tag, so pattern    //
+//                        must be written last.                               //
+//                                                                            //
+// When these tags are used on a slice or map of strings or numbers, min,     //
+// max, enum, pattern and the formats apply to each element. Struct fields,   //
+// pointers to structs, and slices and maps of structs are validated          //
+// recursively. Constraints are checked for every value in the body, even     //
+// false, 0 or "", but not for missing fields and nulls. Use the required tag //
+// to make sure that a field is present.                                      //
+//                                                                            //
+// Every violation, including missing required fields and read-only fields    //
+// that were set, is collected into the Fields of a single 422 Error.         //
+////////////////////////////////////////////////////////////////////////////////
+const (
+	sleepyMin     = "min"
+	sleepyMax     = "max"
+	sleepyMinLen  = "minLen"
+	sleepyMaxLen  = "maxLen"
+	sleepyEnum    = "enum"
+	sleepyEmail   = "email"
+	sleepyURL     = "url"
+	sleepyUUID    = "uuid"
+	sleepyPattern = "pattern"
+)
+
+var emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+////////////////////////////////////////////////////////////////////////////////
+// The precomputed validation rules of a struct model. They are built once    //
+// when Reads() is called, so validating a request only has to walk the       //
+// fields that are required, readonly, or carry a constraint.                 //
+////////////////////////////////////////////////////////////////////////////////
+type structRules struct {
+	fields []*fieldRules
+}
+
+type fieldRules struct {
+	index    int
+	name     string
+	inline   bool
+	required bool
+	readonly bool
+	checks   []check
+	// Checks that apply to each element of a slice or map field.
+	elemChecks []check
+	// Rules of the struct held by the field, or by its elements.
+	nested *structRules
+}
+
+type check struct {
+	rule string
+	arg  string
+	num  float64
+	re   *regexp.Regexp
+	enum []string
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Split a sleepy tag into its rules and their arguments.                     //
+////////////////////////////////////////////////////////////////////////////////
+func parseSleepyTag(tag string) [][2]string {
+	var items [][2]string
+	for tag != "" {
+		var item string
+		if strings.HasPrefix(tag, sleepyPattern+"=") {
+			item, tag = tag, ""
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			item, tag = tag[:i], tag[i+1:]
+		} else {
+			item, tag = tag, ""
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+		items = append(items, [2]string{strings.TrimSpace(kv[0]), kv[1]})
+	}
+	return items
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Build the validation rules of a struct type. Rules are cached by type in   //
+// seen, which also stops the recursion on models that refer to themselves.   //
+// Returns nil if neither the struct nor any nested struct has a constraint.  //
+////////////////////////////////////////////////////////////////////////////////
+func buildStructRules(t reflect.Type, seen map[reflect.Type]*structRules) *structRules {
+	if rules, ok := seen[t]; ok {
+		return rules
+	}
+	rules := &structRules{}
+	seen[t] = rules
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := jsonFieldName(field)
+		if !ok {
+			continue
+		}
+		fr := &fieldRules{index: i, name: name}
+
+		ft := indirectType(field.Type)
+		elem := ft
+		if ft.Kind() == reflect.Slice || ft.Kind() == reflect.Array || ft.Kind() == reflect.Map {
+			elem = indirectType(ft.Elem())
+		}
+		if field.Anonymous && ft.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			fr.inline = true
+		}
+		if elem.Kind() == reflect.Struct && elem != timeType {
+			fr.nested = buildStructRules(elem, seen)
+		}
+
+		for _, item := range parseSleepyTag(field.Tag.Get("sleepy")) {
+			switch item[0] {
+			case sleepyRequired:
+				fr.required = true
+				continue
+			case sleepyReadOnly:
+				fr.readonly = true
+				continue
+			}
+			c, ok := newCheck(item[0], item[1], ft, elem)
+			if !ok {
+				continue
+			}
+			if ft != elem && c.rule != sleepyMinLen && c.rule != sleepyMaxLen {
+				fr.elemChecks = append(fr.elemChecks, c)
+			} else {
+				fr.checks = append(fr.checks, c)
+			}
+		}
+		if fr.required || fr.readonly || len(fr.checks) > 0 || len(fr.elemChecks) > 0 || fr.nested != nil {
+			rules.fields = append(rules.fields, fr)
+		}
+	}
+	if len(rules.fields) == 0 {
+		// Models that refer to this type while it was being built keep the
+		// empty rules, everything else can skip it entirely.
+		seen[t] = nil
+		return nil
+	}
+	return rules
+}
+
+// newCheck builds a single check for a field of type ft whose elements are of
+// type elem. Tags that are not constraints, or don't fit the type of the
+// field, are skipped.
+func newCheck(rule, arg string, ft, elem reflect.Type) (check, bool) {
+	c := check{rule: rule, arg: arg}
+	misuse := func(kind string) (check, bool) {
+		log.Critical("The sleepy tag '%s' can only be used on %s fields, not %s.", rule, kind, ft)
+		return c, false
+	}
+	var err error
+	switch rule {
+	case sleepyMin, sleepyMax:
+		if !isNumberKind(elem.Kind()) {
+			return misuse("number")
+		}
+		c.num, err = strconv.ParseFloat(arg, 64)
+	case sleepyMinLen, sleepyMaxLen:
+		switch ft.Kind() {
+		case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		default:
+			return misuse("string, slice or map")
+		}
+		c.num, err = strconv.ParseFloat(arg, 64)
+	case sleepyEnum:
+		c.enum = strings.Split(arg, "|")
+	case sleepyPattern:
+		if elem.Kind() != reflect.String {
+			return misuse("string")
+		}
+		c.re, err = regexp.Compile(arg)
+	case sleepyEmail, sleepyURL, sleepyUUID:
+		if elem.Kind() != reflect.String {
+			return misuse("string")
+		}
+	default:
+		return c, false
+	}
+	if err != nil {
+		log.Critical("The argument of the sleepy tag '%s' is invalid: %s", rule, err.Error())
+		return c, false
+	}
+	return c, true
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// How validate enforces the required and readonly tags. If present is not    //
+// nil, a field counts as set when its key was present in the request body,   //
+// even as false, 0 or null, and constraints are checked for every present    //
+// value that isn't null. Without it, for codecs that can't tell which keys   //
+// were present, a field counts as set when it has a non-zero value.          //
+////////////////////////////////////////////////////////////////////////////////
+type tagMode struct {
+	require  bool
+	readonly bool
+	present  fieldSet
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Validate a value against the rules of its struct type, collecting every    //
+// violation. Fields are named by their JSON path, e.g. "address.zip" or      //
+// "items[2].name", prefixed by path. Required fields are only enforced when  //
+// mode.require is true, since only a POST is expected to send the whole      //
+// model.                                                                     //
+////////////////////////////////////////////////////////////////////////////////
+func (rules *structRules) validate(v reflect.Value, path string, mode tagMode, problems []FieldError) []FieldError {
+	v = reflect.Indirect(v)
+	if rules == nil || !v.IsValid() {
+		return problems
+	}
+	for _, fr := range rules.fields {
+		fv := v.Field(fr.index)
+		fieldPath := joinPath(path, fr.name)
+		if fr.inline {
+			fieldPath = path
+		}
+		set := !isZero(fv)
+		valued := set
+		if mode.present != nil && !fr.inline {
+			// The fields of inline structs are looked up on their own.
+			set, valued = mode.present.has(fieldPath), mode.present.hasValue(fieldPath)
+		}
+		if mode.require && fr.required && !set {
+			problems = append(problems, FieldError{Field: fieldPath, Rule: sleepyRequired, Message: "Required field: " + fieldPath + " is missing."})
+			continue
+		}
+		if mode.readonly && fr.readonly && set {
+			problems = append(problems, FieldError{Field: fieldPath, Rule: sleepyReadOnly, Message: "Attempting to set read-only field: " + fieldPath + "."})
+			continue
+		}
+		for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		if !valued {
+			// A missing struct can still be missing required fields of its
+			// own. The fields of an inline struct are promoted, so they are
+			// looked up in the present set like any other field.
+			if fr.inline && fv.Kind() == reflect.Ptr {
+				fv = reflect.New(fv.Type().Elem()).Elem()
+			}
+			if fv.Kind() == reflect.Struct && (mode.present == nil || fr.inline) {
+				problems = fr.nested.validate(fv, fieldPath, mode, problems)
+			}
+			continue
+		}
+		if fv.Kind() == reflect.Ptr {
+			// A nil embedded struct, there is nothing to check.
+			continue
+		}
+
+		for _, c := range fr.checks {
+			if msg := c.validate(fv); msg != "" {
+				problems = append(problems, FieldError{Field: fieldPath, Rule: c.rule, Message: fieldPath + " " + msg})
+			}
+		}
+
+		switch fv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < fv.Len(); i++ {
+				problems = fr.validateElem(fv.Index(i), fmt.Sprintf("%s[%d]", fieldPath, i), mode, problems)
+			}
+		case reflect.Map:
+			for _, key := range fv.MapKeys() {
+				problems = fr.validateElem(fv.MapIndex(key), joinPath(fieldPath, fmt.Sprint(key)), mode, problems)
+			}
+		case reflect.Struct:
+			problems = fr.nested.validate(fv, fieldPath, mode, problems)
+		}
+	}
+	return problems
+}
+
+func (fr *fieldRules) validateElem(ev reflect.Value, path string, mode tagMode, problems []FieldError) []FieldError {
+	ev = reflect.Indirect(ev)
+	if !ev.IsValid() {
+		return problems
+	}
+	for _, c := range fr.elemChecks {
+		if msg := c.validate(ev); msg != "" {
+			problems = append(problems, FieldError{Field: path, Rule: c.rule, Message: path + " " + msg})
+		}
+	}
+	if ev.Kind() == reflect.Struct {
+		problems = fr.nested.validate(ev, path, mode, problems)
+	}
+	return problems
+}
+
+// validate returns a description of the problem if v breaks the check, or an
+// empty string if it is valid.
+func (c check) validate(v reflect.Value) string {
+	switch c.rule {
+	case sleepyMin:
+		if numberValue(v) < c.num {
+			return "must be at least " + c.arg + "."
+		}
+	case sleepyMax:
+		if numberValue(v) > c.num {
+			return "must be at most " + c.arg + "."
+		}
+	case sleepyMinLen:
+		if float64(lengthOf(v)) < c.num {
+			return "must have a length of at least " + c.arg + "."
+		}
+	case sleepyMaxLen:
+		if float64(lengthOf(v)) > c.num {
+			return "must have a length of at most " + c.arg + "."
+		}
+	case sleepyEnum:
+		s := fmt.Sprint(v)
+		for _, e := range c.enum {
+			if s == e {
+				return ""
+			}
+		}
+		return "must be one of: " + strings.Join(c.enum, ", ") + "."
+	case sleepyPattern:
+		if !c.re.MatchString(v.String()) {
+			return "must match the pattern " + c.arg + "."
+		}
+	case sleepyEmail:
+		if addr, err := mail.ParseAddress(v.String()); err != nil || addr.Address != v.String() || !emailPattern.MatchString(addr.Address) {
+			return "must be an email address."
+		}
+	case sleepyURL:
+		if u, err := url.ParseRequestURI(v.String()); err != nil || u.Scheme == "" || u.Host == "" {
+			return "must be an absolute URL."
+		}
+	case sleepyUUID:
+		if !uuidPattern.MatchString(v.String()) {
+			return "must be a UUID."
+		}
+	}
+	return ""
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func numberValue(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+func lengthOf(v reflect.Value) int {
+	if v.Kind() == reflect.String {
+		return utf8.RuneCountInString(v.String())
+	}
+	return v.Len()
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,91 @@
+package sleepy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type validAddress struct {
+	City string `json:"city" sleepy:"required"`
+	Zip  string `json:"zip" sleepy:"minLen=5"`
+}
+
+type validUser struct {
+	ID      string         `json:"id" sleepy:"readonly"`
+	Name    string         `json:"name" sleepy:"required,minLen=2"`
+	Active  bool           `json:"active" sleepy:"required"`
+	Age     int            `json:"age" sleepy:"required,min=0,max=150"`
+	Nick    *string        `json:"nick" sleepy:"minLen=2"`
+	Address *validAddress  `json:"address"`
+	Homes   []validAddress `json:"homes"`
+}
+
+type validBase struct {
+	ID string `json:"id" sleepy:"required"`
+}
+
+type validItem struct {
+	validBase
+	*ValidStamp
+	Name string `json:"name"`
+}
+
+type ValidStamp struct {
+	Stamp string `json:"stamp" sleepy:"required,minLen=3"`
+}
+
+func TestValidation(t *testing.T) {
+	res := NewResource("/users")
+	res.Route("").Method("POST").Reads(validUser{}).Returns(validUser{}).To(echo)
+	res.Route("").Method("PUT").Reads(validUser{}).Returns(validUser{}).To(echo)
+	res.Route("/items").Method("POST").Reads(validItem{}).Returns(validItem{}).To(echo)
+
+	post := func(title, body string, fields ...string) httpCase {
+		return validationCase(title, "POST", body, "application/json", fields)
+	}
+	put := func(title, body string, fields ...string) httpCase {
+		return validationCase(title, "PUT", body, "application/json", fields)
+	}
+	runCases(t, newTestAPI(t, res), []httpCase{
+		post("complete", `{"name": "Ann", "active": true, "age": 30}`),
+		post("zero values are present", `{"name": "Al", "active": false, "age": 0}`),
+		post("null is present", `{"name": "Al", "active": null, "age": 0}`),
+		post("missing", `{"name": "Al"}`, "active:required", "age:required"),
+		post("empty body", `{}`, "active:required", "age:required", "name:required"),
+		put("partial update", `{"name": "Al"}`),
+		post("read-only zero value", `{"id": "", "name": "Al", "active": true, "age": 1}`, "id:readonly"),
+		put("read-only null", `{"id": null}`, "id:readonly"),
+		put("constraint on zero value", `{"name": ""}`, "name:minLen"),
+		put("constraint on null pointer", `{"nick": null}`),
+		put("constraint on pointer", `{"nick": "x"}`, "nick:minLen"),
+		put("bounds", `{"age": -1}`, "age:min"),
+		post("nested missing", `{"name": "Al", "active": true, "age": 1, "address": {"zip": "12345"}}`, "address.city:required"),
+		put("nested missing in update", `{"address": {"zip": "12345"}}`),
+		put("nested null", `{"address": null}`),
+		put("nested zero value", `{"address": {"city": ""}}`),
+		post("list", `{"name": "Al", "active": true, "age": 1, "homes": [{"city": "a"}, {"zip": "1"}]}`, "homes[1].city:required", "homes[1].zip:minLen"),
+
+		// The fields of embedded structs are promoted, even when the struct
+		// is zero or a nil pointer
+		validationCase("embedded missing", "POST", `{"name": "x"}`, "application/json", []string{"id:required", "stamp:required"}, "/items"),
+		validationCase("embedded zero values", "POST", `{"id": "", "stamp": "abc"}`, "application/json", nil, "/items"),
+		validationCase("embedded constraint", "POST", `{"id": "1", "stamp": "a"}`, "application/json", []string{"stamp:minLen"}, "/items"),
+		validationCase("embedded xml", "POST", `<validItem><Name>x</Name></validItem>`, "application/xml", []string{"id:required", "stamp:required"}, "/items"),
+
+		// XML can't tell which fields were sent, so zero values count as
+		// missing
+		validationCase("xml zero values", "POST", `<validUser><Name>Al</Name><Age>0</Age></validUser>`, "application/xml", []string{"active:required", "age:required"}),
+	})
+}
+
+// validationCase sends a body to /api/users, or the path below it, which must
+// be accepted if there are no fields, or fail with a 422 that lists exactly
+// the fields.
+func validationCase(title, method, body, contentType string, fields []string, path ...string) httpCase {
+	c := httpCase{title: title, method: method, url: "/api/users" + strings.Join(path, ""), body: body, headers: []string{"Content-Type", contentType}, status: http.StatusOK}
+	if len(fields) > 0 {
+		c.status, c.check = http.StatusUnprocessableEntity, hasFieldErrors(fields...)
+	}
+	return c
+}